@@ -0,0 +1,302 @@
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// AirPollutionResponse is the response of the OpenWeather air pollution API
+type AirPollutionResponse struct {
+	Coord Coord              `json:"coord"`
+	List  []AirPollutionItem `json:"list"`
+}
+
+// AirPollutionItem holds the air quality index and pollutant concentrations
+type AirPollutionItem struct {
+	Dt   int64 `json:"dt"`
+	Main struct {
+		Aqi int `json:"aqi"`
+	} `json:"main"`
+	Components AirComponents `json:"components"`
+}
+
+// AirComponents are pollutant concentrations, μg/m³
+type AirComponents struct {
+	CO   float64 `json:"co"`
+	NO   float64 `json:"no"`
+	NO2  float64 `json:"no2"`
+	O3   float64 `json:"o3"`
+	SO2  float64 `json:"so2"`
+	PM25 float64 `json:"pm2_5"`
+	PM10 float64 `json:"pm10"`
+	NH3  float64 `json:"nh3"`
+}
+
+// openMeteoAirQualityResponse is the response of the Open-Meteo air quality API,
+// pollen is only forecast for Europe and is null elsewhere
+type openMeteoAirQualityResponse struct {
+	Current struct {
+		Time          int64    `json:"time"`
+		AlderPollen   *float64 `json:"alder_pollen"`
+		BirchPollen   *float64 `json:"birch_pollen"`
+		GrassPollen   *float64 `json:"grass_pollen"`
+		MugwortPollen *float64 `json:"mugwort_pollen"`
+		OlivePollen   *float64 `json:"olive_pollen"`
+		RagweedPollen *float64 `json:"ragweed_pollen"`
+	} `json:"current"`
+	Hourly struct {
+		Time    []int64    `json:"time"`
+		UVIndex []*float64 `json:"uv_index"`
+	} `json:"hourly"`
+}
+
+// AirQuality is the current air quality of a place
+type AirQuality struct {
+	Time time.Time
+	// AQI is the OpenWeather air quality index from 1 (good) to 5 (very poor)
+	AQI  int
+	PM25 float64
+	PM10 float64
+	O3   float64
+	// UVIndex is the maximum UV index of the day, nil if it is unknown
+	UVIndex *float64
+	// Pollen are concentrations of pollen in the air, grains/m³, plants without data are left out
+	Pollen []Pollen
+}
+
+// Pollen is the concentration of pollen of a plant
+type Pollen struct {
+	Plant string // russian name of the plant
+	Count float64
+}
+
+// uvLevels are russian names of UV index levels by their lower bound
+var uvLevels = []struct {
+	From float64
+	Name string
+}{
+	{11, "экстремальный"},
+	{8, "очень высокий"},
+	{6, "высокий"},
+	{3, "умеренный"},
+	{0, "низкий"},
+}
+
+// UVLevel returns the russian name of the UV index level
+func (a AirQuality) UVLevel() string {
+	if a.UVIndex == nil {
+		return "нет данных"
+	}
+	for _, l := range uvLevels {
+		if *a.UVIndex >= l.From {
+			return l.Name
+		}
+	}
+	return "низкий"
+}
+
+// airQualityLevels are names of the AQI levels starting with 1
+var airQualityLevels = []string{"хорошо", "удовлетворительно", "умеренно", "плохо", "очень плохо"}
+
+// Level returns the russian name of the AQI level
+func (a AirQuality) Level() string {
+	if a.AQI < 1 || a.AQI > len(airQualityLevels) {
+		return "нет данных"
+	}
+	return airQualityLevels[a.AQI-1]
+}
+
+// Emoji returns a colored marker of the AQI level
+func (a AirQuality) Emoji() string {
+	switch {
+	case a.AQI <= 1:
+		return "🟢"
+	case a.AQI == 2:
+		return "🟡"
+	case a.AQI == 3:
+		return "🟠"
+	case a.AQI == 4:
+		return "🔴"
+	default:
+		return "🟣"
+	}
+}
+
+// GetAirQuality returns the current air quality for the given coordinates
+func (w *WeatherAPI) GetAirQuality(lat, lon float64) (*AirQuality, error) {
+	data, err := w.callAirPollutionAPI(lat, lon)
+	if err != nil {
+		return nil, err
+	}
+	if len(data.List) == 0 {
+		return nil, fmt.Errorf("empty air pollution data")
+	}
+	item := data.List[0]
+	aq := &AirQuality{
+		Time: time.Unix(item.Dt, 0),
+		AQI:  item.Main.Aqi,
+		PM25: item.Components.PM25,
+		PM10: item.Components.PM10,
+		O3:   item.Components.O3,
+	}
+
+	// UV index and pollen are an addition, the air quality is shown without them if Open-Meteo fails.
+	// Open-Meteo limits all of its APIs together, so its quota is shared with the forecasts
+	ctx := context.Background()
+	openMeteo := (&OpenMeteoProvider{}).Name()
+	if exhausted, _ := w.DBClient.IsWeatherProviderExhausted(ctx, openMeteo); exhausted {
+		return aq, nil
+	}
+	extra, err := w.callOpenMeteoAirQualityAPI(lat, lon)
+	if err != nil {
+		slog.Warn("could not get uv index and pollen", "lat", lat, "lon", lon, "err", err)
+		if errors.Is(err, ErrQuotaExceeded) {
+			if err := w.DBClient.SetWeatherProviderExhausted(ctx, openMeteo, providerExhaustedTTL); err != nil {
+				slog.Warn("could not mark weather provider exhausted", "provider", openMeteo, "err", err)
+			}
+		}
+		return aq, nil
+	}
+	for _, uv := range extra.Hourly.UVIndex {
+		if uv != nil && (aq.UVIndex == nil || *uv > *aq.UVIndex) {
+			aq.UVIndex = uv
+		}
+	}
+	for _, p := range []struct {
+		Plant string
+		Count *float64
+	}{
+		{"ольха", extra.Current.AlderPollen},
+		{"береза", extra.Current.BirchPollen},
+		{"злаки", extra.Current.GrassPollen},
+		{"полынь", extra.Current.MugwortPollen},
+		{"олива", extra.Current.OlivePollen},
+		{"амброзия", extra.Current.RagweedPollen},
+	} {
+		if p.Count != nil {
+			aq.Pollen = append(aq.Pollen, Pollen{Plant: p.Plant, Count: *p.Count})
+		}
+	}
+	return aq, nil
+}
+
+// callOpenMeteoAirQualityAPI gets the current pollen and the hourly UV index of today
+func (w *WeatherAPI) callOpenMeteoAirQualityAPI(lat, lon float64) (*openMeteoAirQualityResponse, error) {
+	const maxRetry = 3
+	var data openMeteoAirQualityResponse
+	ctx := context.Background()
+	baseURL := "https://air-quality-api.open-meteo.com/v1/air-quality"
+	queryStr := fmt.Sprintf(
+		"?latitude=%f&longitude=%f&timezone=auto&timeformat=unixtime&forecast_days=1&hourly=uv_index"+
+			"&current=alder_pollen,birch_pollen,grass_pollen,mugwort_pollen,olive_pollen,ragweed_pollen",
+		lat, lon,
+	)
+
+	v, err := w.DBClient.GetOpenMeteoAirQualityData(ctx, lat, lon)
+	if err == nil {
+		slog.Info("hit openmeteo air quality cache", "key", w.DBClient.OpenMeteoAirQualityKey(lat, lon))
+		err := json.Unmarshal([]byte(v), &data)
+		if err == nil {
+			return &data, nil
+		}
+	}
+
+	for i := 1; i <= maxRetry; i++ {
+		resp, err := w.HttpClient.Get(baseURL + queryStr)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return nil, fmt.Errorf("%w: %s - %s", ErrQuotaExceeded, resp.Status, string(body))
+		}
+
+		if resp.StatusCode/100 == 2 {
+			err := w.DBClient.SetOpenMeteoAirQualityData(ctx, lat, lon, body)
+			if err != nil {
+				slog.Info("could not write cache", "err", err)
+			}
+			err = json.Unmarshal(body, &data)
+			if err != nil {
+				return nil, err
+			}
+			return &data, nil
+		}
+
+		if i < maxRetry {
+			slog.Info("got error response from api, retrying in 5 seconds...", "retry-cnt", i, "status", resp.Status, "body", string(body))
+			time.Sleep(5 * time.Second)
+		} else {
+			return nil, fmt.Errorf("got error response from api: %s - %s", resp.Status, string(body))
+		}
+	}
+
+	return nil, fmt.Errorf("max retries reached")
+}
+
+func (w *WeatherAPI) callAirPollutionAPI(lat, lon float64) (*AirPollutionResponse, error) {
+	const maxRetry = 3
+	var data AirPollutionResponse
+	ctx := context.Background()
+	baseURL := "https://api.openweathermap.org/data/2.5/air_pollution"
+	queryStr := fmt.Sprintf("?lat=%f&lon=%f&appid=%s", lat, lon, w.ApiKey)
+
+	v, err := w.DBClient.GetAirPollutionData(ctx, lat, lon)
+	if err == nil {
+		slog.Info("hit air pollution cache", "key", w.DBClient.AirPollutionKey(lat, lon))
+		err := json.Unmarshal([]byte(v), &data)
+		if err == nil {
+			return &data, nil
+		}
+	}
+
+	for i := 1; i <= maxRetry; i++ {
+		resp, err := w.HttpClient.Get(baseURL + queryStr)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return nil, fmt.Errorf("%w: %s - %s", ErrQuotaExceeded, resp.Status, string(body))
+		}
+
+		if resp.StatusCode/100 == 2 {
+			err := w.DBClient.SetAirPollutionData(ctx, lat, lon, body)
+			if err != nil {
+				slog.Info("could not write cache", "err", err)
+			}
+			err = json.Unmarshal(body, &data)
+			if err != nil {
+				return nil, err
+			}
+			return &data, nil
+		}
+
+		if i < maxRetry {
+			slog.Info("got error response from api, retrying in 5 seconds...", "retry-cnt", i, "status", resp.Status, "body", string(body))
+			time.Sleep(5 * time.Second)
+		} else {
+			return nil, fmt.Errorf("got error response from api: %s - %s", resp.Status, string(body))
+		}
+	}
+
+	return nil, fmt.Errorf("max retries reached")
+}
@@ -0,0 +1,168 @@
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rahfar/familybot/src/db"
+)
+
+// CBRProvider gets official rates of the Central Bank of Russia against RUB
+type CBRProvider struct {
+	HttpClient *http.Client
+	DBClient   *db.Client
+}
+
+type cbrValCurs struct {
+	Date    string `xml:"Date,attr"`
+	Valutes []struct {
+		CharCode string `xml:"CharCode"`
+		Nominal  string `xml:"Nominal"`
+		Value    string `xml:"Value"`
+	} `xml:"Valute"`
+}
+
+// windows1251 maps the upper half of the windows-1251 code page to unicode
+var windows1251 = [128]rune{
+	'Ђ', 'Ѓ', '‚', 'ѓ', '„', '…', '†', '‡', '€', '‰', 'Љ', '‹', 'Њ', 'Ќ', 'Ћ', 'Џ',
+	'ђ', '‘', '’', '“', '”', '•', '–', '—', '�', '™', 'љ', '›', 'њ', 'ќ', 'ћ', 'џ',
+	' ', 'Ў', 'ў', 'Ј', '¤', 'Ґ', '¦', '§', 'Ё', '©', 'Є', '«', '¬', '­', '®', 'Ї',
+	'°', '±', 'І', 'і', 'ґ', 'µ', '¶', '·', 'ё', '№', 'є', '»', 'ј', 'Ѕ', 'ѕ', 'ї',
+	'А', 'Б', 'В', 'Г', 'Д', 'Е', 'Ж', 'З', 'И', 'Й', 'К', 'Л', 'М', 'Н', 'О', 'П',
+	'Р', 'С', 'Т', 'У', 'Ф', 'Х', 'Ц', 'Ч', 'Ш', 'Щ', 'Ъ', 'Ы', 'Ь', 'Э', 'Ю', 'Я',
+	'а', 'б', 'в', 'г', 'д', 'е', 'ж', 'з', 'и', 'й', 'к', 'л', 'м', 'н', 'о', 'п',
+	'р', 'с', 'т', 'у', 'ф', 'х', 'ц', 'ч', 'ш', 'щ', 'ъ', 'ы', 'ь', 'э', 'ю', 'я',
+}
+
+// decodeWindows1251 converts windows-1251 encoded text to UTF-8
+func decodeWindows1251(data []byte) string {
+	var sb strings.Builder
+	sb.Grow(len(data) * 2)
+	for _, c := range data {
+		if c < 0x80 {
+			sb.WriteByte(c)
+		} else {
+			sb.WriteRune(windows1251[c-0x80])
+		}
+	}
+	return sb.String()
+}
+
+// windows1251Reader is an xml.Decoder CharsetReader for windows-1251 documents
+func windows1251Reader(charset string, input io.Reader) (io.Reader, error) {
+	if !strings.EqualFold(charset, "windows-1251") {
+		return nil, fmt.Errorf("unsupported charset %s", charset)
+	}
+	body, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	return strings.NewReader(decodeWindows1251(body)), nil
+}
+
+func (c *CBRProvider) Name() string {
+	return "cbr"
+}
+
+func (c *CBRProvider) Latest() (*ExchangeRates, error) {
+	return c.callAPI(time.Time{})
+}
+
+func (c *CBRProvider) Historical(date time.Time) (*ExchangeRates, error) {
+	return c.callAPI(date)
+}
+
+// parseCBRRates converts the CBR daily XML into rates of currencies per one RUB
+func parseCBRRates(data []byte) (*ExchangeRates, error) {
+	var valCurs cbrValCurs
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = windows1251Reader
+	if err := decoder.Decode(&valCurs); err != nil {
+		return nil, err
+	}
+	if len(valCurs.Valutes) == 0 {
+		return nil, fmt.Errorf("no rates in cbr response")
+	}
+
+	xr := &ExchangeRates{Data: map[string]Rate{"RUB": {Code: "RUB", Value: 1}}}
+	if t, err := time.Parse("02.01.2006", valCurs.Date); err == nil {
+		xr.Meta.Update_time = t
+	}
+	for _, v := range valCurs.Valutes {
+		nominal, err1 := strconv.ParseFloat(v.Nominal, 64)
+		value, err2 := strconv.ParseFloat(strings.Replace(v.Value, ",", ".", 1), 64)
+		if err1 != nil || err2 != nil || value == 0 {
+			slog.Warn("invalid cbr rate", "currency", v.CharCode, "nominal", v.Nominal, "value", v.Value)
+			continue
+		}
+		xr.Data[v.CharCode] = Rate{Code: v.CharCode, Value: nominal / value}
+	}
+	return xr, nil
+}
+
+// callAPI fetches the daily XML, a zero date means the latest published rates
+func (c *CBRProvider) callAPI(date time.Time) (*ExchangeRates, error) {
+	const maxRetry = 3
+	ctx := context.Background()
+	url := "https://www.cbr.ru/scripts/XML_daily.asp"
+	cacheDate, ttl := time.Now().UTC(), time.Hour
+	if !date.IsZero() {
+		url += "?date_req=" + date.Format("02/01/2006")
+		cacheDate, ttl = date, 7*24*time.Hour
+	}
+	cacheKey := c.Name()
+	if date.IsZero() {
+		cacheKey += "_latest"
+	}
+
+	v, err := c.DBClient.GetRatesData(ctx, cacheKey, cacheDate)
+	if err == nil {
+		slog.Info("hit cbr cache", "key", c.DBClient.RatesKey(cacheKey, cacheDate))
+		if xr, err := parseCBRRates([]byte(v)); err == nil {
+			xr.Source = c.Name()
+			return xr, nil
+		}
+	}
+
+	for i := 1; i <= maxRetry; i++ {
+		resp, err := c.HttpClient.Get(url)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode/100 == 2 {
+			xr, err := parseCBRRates(body)
+			if err != nil {
+				return nil, err
+			}
+			if err := c.DBClient.SetRatesData(ctx, cacheKey, cacheDate, body, ttl); err != nil {
+				slog.Info("could not write cache", "err", err)
+			}
+			xr.Source = c.Name()
+			return xr, nil
+		}
+
+		if i < maxRetry {
+			slog.Info("got error response from api, retrying in 5 seconds...", "retry-cnt", i, "status", resp.Status)
+			time.Sleep(5 * time.Second)
+		} else {
+			return nil, fmt.Errorf("got error response from api: %s", resp.Status)
+		}
+	}
+
+	return nil, fmt.Errorf("max retries reached")
+}
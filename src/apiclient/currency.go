@@ -2,93 +2,333 @@ package apiclient
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log/slog"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/rahfar/familybot/src/db"
 )
 
+// ExchangeAPI gets exchange rates from several providers and keeps the daily history
 type ExchangeAPI struct {
-	ApiKey      string
-	HttpClient  *http.Client
-	DBClient *db.Client
+	HttpClient *http.Client
+	DBClient   *db.Client
+	// Providers are tried in this order unless the pair has its own order
+	Providers []RatesProvider
+	// PairProviders maps pairs like "USD/RUB" to names of providers in the order they are tried
+	PairProviders map[string][]string
+	// known are all providers by name
+	known map[string]RatesProvider
 }
 
+// ratesProviderExhaustedTTL is how long a provider is skipped after it ran out of quota
+const ratesProviderExhaustedTTL = 12 * time.Hour
+
 type ExchangeRates struct {
 	Meta struct {
 		Update_time time.Time `json:"last_updated_at"`
 	} `json:"meta"`
-	Data struct {
-		BTC struct {
-			Value float64 `json:"value"`
-		} `json:"BTC"`
-		EUR struct {
-			Value float64 `json:"value"`
-		} `json:"EUR"`
-		RUB struct {
-			Value float64 `json:"value"`
-		} `json:"RUB"`
-	} `json:"data"`
-}
-
-func (e *ExchangeAPI) GetExchangeRates(datetime time.Time) (*ExchangeRates, error) {
-	const maxRetry = 3
-	var xr ExchangeRates
-	var baseURL, queryStr string
-	ctx := context.Background()
-
-	if datetime.Before(time.Now().Add(-24 * time.Hour)) {
-		baseURL = "https://api.currencyapi.com/v3/historical"
-		queryStr = fmt.Sprintf("?apikey=%s&date=%s", e.ApiKey, datetime.Format("2006-01-02"))
-	} else {
-		baseURL = "https://api.currencyapi.com/v3/latest"
-		queryStr = fmt.Sprintf("?apikey=%s", e.ApiKey)
+	// Data holds rates of currencies against the base currency of the provider by currency code
+	Data map[string]Rate `json:"data"`
+	// Source is the name of the provider
+	Source string `json:"-"`
+}
+
+type Rate struct {
+	Code  string  `json:"code"`
+	Value float64 `json:"value"`
+}
+
+// CurrencyPair is a pair of currencies, its rate is the price of one Base in Quote
+type CurrencyPair struct {
+	Base  string
+	Quote string
+}
+
+// ParseCurrencyPair parses pairs like "EUR/RUB"
+func ParseCurrencyPair(s string) (CurrencyPair, error) {
+	base, quote, ok := strings.Cut(strings.ToUpper(strings.TrimSpace(s)), "/")
+	if !ok || base == "" || quote == "" || base == quote {
+		return CurrencyPair{}, fmt.Errorf("invalid currency pair %q", s)
 	}
+	return CurrencyPair{Base: base, Quote: quote}, nil
+}
 
-	v, err := e.DBClient.GetCurrencyRates(ctx, datetime)
-	if err == nil {
-		slog.Info("hit currencyapi cache", "key", e.DBClient.CurrencyKey(datetime))
-		err := json.Unmarshal([]byte(v), &xr)
-		if err == nil {
-			return &xr, nil
+func (p CurrencyPair) String() string {
+	return p.Base + "/" + p.Quote
+}
+
+// Convert converts the amount between any currencies through the base currency of the rates
+func (xr *ExchangeRates) Convert(amount float64, from, to string) (float64, error) {
+	fromRate, ok := xr.Data[strings.ToUpper(from)]
+	if !ok || fromRate.Value == 0 {
+		return 0, fmt.Errorf("unknown currency %s", from)
+	}
+	toRate, ok := xr.Data[strings.ToUpper(to)]
+	if !ok {
+		return 0, fmt.Errorf("unknown currency %s", to)
+	}
+	return amount / fromRate.Value * toRate.Value, nil
+}
+
+// PairRate returns the price of one base currency of the pair in the quote currency
+func (xr *ExchangeRates) PairRate(p CurrencyPair) (float64, error) {
+	return xr.Convert(1, p.Base, p.Quote)
+}
+
+// NewExchangeAPI creates the exchange rates client, providers is a comma-separated list of provider names
+// in the default order, pairProviders overrides the order per pair: "USD/RUB=cbr,currencyapi;EUR/USD=ecb"
+func NewExchangeAPI(apiKey string, providers string, pairProviders string, httpClient *http.Client, dbClient *db.Client) *ExchangeAPI {
+	known := map[string]RatesProvider{}
+	for _, p := range []RatesProvider{
+		&CurrencyAPIProvider{ApiKey: apiKey, HttpClient: httpClient, DBClient: dbClient},
+		&CBRProvider{HttpClient: httpClient, DBClient: dbClient},
+		&ECBProvider{HttpClient: httpClient, DBClient: dbClient},
+	} {
+		known[p.Name()] = p
+	}
+
+	exchangeAPI := &ExchangeAPI{
+		HttpClient:    httpClient,
+		DBClient:      dbClient,
+		Providers:     make([]RatesProvider, 0),
+		PairProviders: make(map[string][]string),
+		known:         known,
+	}
+	for _, name := range strings.Split(providers, ",") {
+		name = strings.TrimSpace(name)
+		if p, ok := known[name]; ok {
+			exchangeAPI.Providers = append(exchangeAPI.Providers, p)
+		} else if name != "" {
+			slog.Warn("unknown rates provider", "provider", name)
 		}
 	}
+	if len(exchangeAPI.Providers) == 0 {
+		slog.Warn("no rates providers configured, using currencyapi")
+		exchangeAPI.Providers = append(exchangeAPI.Providers, known["currencyapi"])
+	}
 
-	for i := 1; i <= maxRetry; i++ {
-		resp, err := e.HttpClient.Get(baseURL + queryStr)
+	for _, entry := range strings.Split(pairProviders, ";") {
+		pairStr, names, ok := strings.Cut(entry, "=")
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		pair, err := ParseCurrencyPair(pairStr)
+		if !ok || err != nil {
+			slog.Warn("invalid pair providers entry", "entry", entry)
+			continue
+		}
+		for _, name := range strings.Split(names, ",") {
+			name = strings.TrimSpace(name)
+			if _, ok := known[name]; !ok {
+				slog.Warn("unknown rates provider", "provider", name, "pair", pair)
+				continue
+			}
+			exchangeAPI.PairProviders[pair.String()] = append(exchangeAPI.PairProviders[pair.String()], name)
+		}
+	}
+	return exchangeAPI
+}
+
+// HistoryPoint is the end-of-day rate of a currency pair
+type HistoryPoint struct {
+	Date time.Time
+	Rate float64
+}
+
+// truncateDay returns the beginning of the UTC day
+func truncateDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// providersFor returns providers for the pair in the order they are tried, providers that ran out of quota are skipped
+func (e *ExchangeAPI) providersFor(pair CurrencyPair) []RatesProvider {
+	providers := e.Providers
+	if names, ok := e.PairProviders[pair.String()]; ok {
+		providers = make([]RatesProvider, 0, len(names))
+		for _, name := range names {
+			providers = append(providers, e.known[name])
+		}
+	}
+
+	available := make([]RatesProvider, 0, len(providers))
+	for _, p := range providers {
+		exhausted, err := e.DBClient.IsRatesProviderExhausted(context.Background(), p.Name())
 		if err != nil {
-			return nil, err
+			slog.Warn("could not check rates provider quota", "provider", p.Name(), "err", err)
+		}
+		if !exhausted {
+			available = append(available, p)
+		}
+	}
+	return available
+}
+
+// ratesOn returns end-of-day rates of a past date from the persistent history of the provider,
+// a missing day is fetched and stored, for the current day the latest rates are returned
+func (e *ExchangeAPI) ratesOn(p RatesProvider, date time.Time) (*ExchangeRates, error) {
+	var xr *ExchangeRates
+	var err error
+	date = truncateDay(date)
+	if !date.Before(truncateDay(time.Now())) {
+		xr, err = p.Latest()
+	} else {
+		history, histErr := e.DBClient.GetCurrencyHistory(context.Background(), p.Name(), []time.Time{date})
+		if histErr != nil {
+			slog.Warn("could not read currency history", "provider", p.Name(), "date", date, "err", histErr)
+		} else if history[0] != nil {
+			return ratesFromHistory(p.Name(), date, history[0]), nil
 		}
-		defer resp.Body.Close()
 
-		body, err := io.ReadAll(resp.Body)
+		xr, err = p.Historical(date)
+		if err == nil {
+			if err := e.storeHistory(p.Name(), date, xr); err != nil {
+				slog.Warn("could not store currency history", "provider", p.Name(), "date", date, "err", err)
+			}
+		}
+	}
+
+	if errors.Is(err, ErrQuotaExceeded) {
+		slog.Warn("rates provider quota exceeded", "provider", p.Name())
+		if err := e.DBClient.SetRatesProviderExhausted(context.Background(), p.Name(), ratesProviderExhaustedTTL); err != nil {
+			slog.Warn("could not mark rates provider exhausted", "provider", p.Name(), "err", err)
+		}
+	}
+	return xr, err
+}
+
+// PairQuotes returns rates of the pair on the given dates from the first provider that knows the rate on the first date,
+// other dates are taken from the same provider and are zero if the provider has no data for them
+func (e *ExchangeAPI) PairQuotes(pair CurrencyPair, dates ...time.Time) ([]Quote, error) {
+	if len(dates) == 0 {
+		return nil, nil
+	}
+	var errs []error
+	for _, p := range e.providersFor(pair) {
+		xr, err := e.ratesOn(p, dates[0])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name(), err))
+			continue
+		}
+		rate, err := xr.PairRate(pair)
 		if err != nil {
-			return nil, err
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name(), err))
+			continue
 		}
 
-		if resp.StatusCode/100 == 2 {
-			if err := e.DBClient.SetCurrencyRates(ctx, datetime, body); err != nil {
-				slog.Info("could not write cache", "err", err)
+		quotes := make([]Quote, len(dates))
+		quotes[0] = Quote{Rate: rate, Source: p.Name(), Time: xr.Meta.Update_time}
+		for i, d := range dates[1:] {
+			xr, err := e.ratesOn(p, d)
+			if err != nil {
+				slog.Warn("could not get rates", "provider", p.Name(), "date", d, "err", err)
+				continue
+			}
+			if rate, err := xr.PairRate(pair); err == nil {
+				quotes[i+1] = Quote{Rate: rate, Source: p.Name(), Time: xr.Meta.Update_time}
+			}
+		}
+		return quotes, nil
+	}
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("no rates providers available for %s", pair)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// PairRate returns the rate of the pair on the date
+func (e *ExchangeAPI) PairRate(pair CurrencyPair, date time.Time) (Quote, error) {
+	quotes, err := e.PairQuotes(pair, date)
+	if err != nil {
+		return Quote{}, err
+	}
+	return quotes[0], nil
+}
+
+// Backfill fetches rates for past days in the range that are missing in the history of every provider,
+// the number of fetched days is returned. Days are fetched from the newest, since providers have a limited
+// history, and a provider is not asked for older days after the first failure
+func (e *ExchangeAPI) Backfill(from, to time.Time) (int, error) {
+	dates := make([]time.Time, 0)
+	for d := truncateDay(from); !d.After(truncateDay(to)) && d.Before(truncateDay(time.Now())); d = d.AddDate(0, 0, 1) {
+		dates = append(dates, d)
+	}
+
+	fetched := 0
+	var errs []error
+	for _, p := range e.Providers {
+		history, err := e.DBClient.GetCurrencyHistory(context.Background(), p.Name(), dates)
+		if err != nil {
+			return fetched, err
+		}
+		for i := len(dates) - 1; i >= 0; i-- {
+			d := dates[i]
+			if history[i] != nil {
+				continue
 			}
-			err := json.Unmarshal(body, &xr)
+			xr, err := p.Historical(d)
 			if err != nil {
-				slog.Error("could not unmarshal json body", "err", err)
-				return nil, err
+				// e.g. ECB serves only the last 90 days, older days would fail the same way
+				errs = append(errs, fmt.Errorf("%s: could not fetch rates for %s and earlier: %w", p.Name(), d.Format("2006-01-02"), err))
+				break
+			}
+			if err := e.storeHistory(p.Name(), d, xr); err != nil {
+				return fetched, err
 			}
-			return &xr, nil
+			fetched++
 		}
+	}
+	return fetched, errors.Join(errs...)
+}
 
-		if i < maxRetry {
-			slog.Info("got error response from api, retrying in 5 seconds...", "retry-cnt", i, "status", resp.Status, "body", string(body))
-			time.Sleep(5 * time.Second)
-		} else {
-			return nil, fmt.Errorf("got error response from api: %s - %s", resp.Status, string(body))
+// GetHistory returns stored end-of-day rates of the pair in the range from the first provider that has them,
+// days without data are skipped
+func (e *ExchangeAPI) GetHistory(pair CurrencyPair, from, to time.Time) ([]HistoryPoint, string, error) {
+	dates := make([]time.Time, 0)
+	for d := truncateDay(from); !d.After(truncateDay(to)); d = d.AddDate(0, 0, 1) {
+		dates = append(dates, d)
+	}
+
+	for _, p := range e.providersFor(pair) {
+		history, err := e.DBClient.GetCurrencyHistory(context.Background(), p.Name(), dates)
+		if err != nil {
+			return nil, "", err
+		}
+		points := make([]HistoryPoint, 0, len(dates))
+		for i, d := range dates {
+			if history[i] == nil {
+				continue
+			}
+			rate, err := ratesFromHistory(p.Name(), d, history[i]).PairRate(pair)
+			if err != nil {
+				continue
+			}
+			points = append(points, HistoryPoint{Date: d, Rate: rate})
+		}
+		if len(points) > 0 {
+			return points, p.Name(), nil
 		}
 	}
+	return nil, "", nil
+}
 
-	return nil, fmt.Errorf("max retries reached")
+func (e *ExchangeAPI) storeHistory(provider string, date time.Time, xr *ExchangeRates) error {
+	rates := make(map[string]float64, len(xr.Data))
+	for code, r := range xr.Data {
+		rates[code] = r.Value
+	}
+	return e.DBClient.SetCurrencyHistory(context.Background(), provider, date, rates)
+}
+
+func ratesFromHistory(provider string, date time.Time, rates map[string]float64) *ExchangeRates {
+	xr := &ExchangeRates{Data: make(map[string]Rate, len(rates)), Source: provider}
+	xr.Meta.Update_time = date
+	for code, v := range rates {
+		xr.Data[code] = Rate{Code: code, Value: v}
+	}
+	return xr
 }
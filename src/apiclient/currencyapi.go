@@ -0,0 +1,108 @@
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/rahfar/familybot/src/db"
+)
+
+// CurrencyAPIProvider gets rates against USD from currencyapi.com
+type CurrencyAPIProvider struct {
+	ApiKey     string
+	HttpClient *http.Client
+	DBClient   *db.Client
+}
+
+func (e *CurrencyAPIProvider) Name() string {
+	return "currencyapi"
+}
+
+func (e *CurrencyAPIProvider) Latest() (*ExchangeRates, error) {
+	return e.callAPI(time.Now().UTC())
+}
+
+func (e *CurrencyAPIProvider) Historical(date time.Time) (*ExchangeRates, error) {
+	return e.callAPI(date)
+}
+
+func (e *CurrencyAPIProvider) callAPI(datetime time.Time) (*ExchangeRates, error) {
+	const maxRetry = 3
+	var xr ExchangeRates
+	var baseURL, queryStr string
+	ctx := context.Background()
+
+	// Past days are not cached here, ExchangeAPI keeps them in the persistent history
+	historical := datetime.Before(time.Now().Add(-24 * time.Hour))
+	if historical {
+		baseURL = "https://api.currencyapi.com/v3/historical"
+		queryStr = fmt.Sprintf("?apikey=%s&date=%s", e.ApiKey, datetime.Format("2006-01-02"))
+	} else {
+		baseURL = "https://api.currencyapi.com/v3/latest"
+		queryStr = fmt.Sprintf("?apikey=%s", e.ApiKey)
+	}
+
+	// Latest rates are cached for an hour like cbr_latest, so alerts see intraday changes,
+	// the daily key keeps the last rates of the day
+	latestKey := e.Name() + "_latest"
+	if !historical {
+		v, err := e.DBClient.GetRatesData(ctx, latestKey, datetime)
+		if err == nil {
+			slog.Info("hit currencyapi cache", "key", e.DBClient.RatesKey(latestKey, datetime))
+			err := json.Unmarshal([]byte(v), &xr)
+			if err == nil {
+				xr.Source = e.Name()
+				return &xr, nil
+			}
+		}
+	}
+
+	for i := 1; i <= maxRetry; i++ {
+		resp, err := e.HttpClient.Get(baseURL + queryStr)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return nil, fmt.Errorf("%w: %s - %s", ErrQuotaExceeded, resp.Status, string(body))
+		}
+
+		if resp.StatusCode/100 == 2 {
+			if !historical {
+				if err := e.DBClient.SetRatesData(ctx, latestKey, datetime, body, time.Hour); err != nil {
+					slog.Info("could not write cache", "err", err)
+				}
+				if err := e.DBClient.SetCurrencyRates(ctx, datetime, body); err != nil {
+					slog.Info("could not write cache", "err", err)
+				}
+			}
+			err := json.Unmarshal(body, &xr)
+			if err != nil {
+				slog.Error("could not unmarshal json body", "err", err)
+				return nil, err
+			}
+			xr.Source = e.Name()
+			return &xr, nil
+		}
+
+		if i < maxRetry {
+			slog.Info("got error response from api, retrying in 5 seconds...", "retry-cnt", i, "status", resp.Status, "body", string(body))
+			time.Sleep(5 * time.Second)
+		} else {
+			return nil, fmt.Errorf("got error response from api: %s - %s", resp.Status, string(body))
+		}
+	}
+
+	return nil, fmt.Errorf("max retries reached")
+}
@@ -8,21 +8,29 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/rahfar/familybot/src/db"
 )
 
 type DeeplAPI struct {
-	DBClient *db.Client
-	HttpClient  *http.Client
-	BaseURL     string
-	ApiKey      string
+	DBClient   *db.Client
+	HttpClient *http.Client
+	BaseURL    string
+	ApiKey     string
 }
 
+// maxDeeplTexts is the limit of texts in one DeepL request
+const maxDeeplTexts = 50
+
 type TranslationIn struct {
 	Text       []string `json:"text"`
+	SourceLang string   `json:"source_lang,omitempty"`
 	TargetLang string   `json:"target_lang"`
+	Formality  string   `json:"formality,omitempty"`
+	GlossaryID string   `json:"glossary_id,omitempty"`
 }
 type TranslationOut struct {
 	Translations []*Translation `json:"translations"`
@@ -30,66 +38,187 @@ type TranslationOut struct {
 type Translation struct {
 	SourceLang string `json:"detected_source_language"`
 	Text       string `json:"text"`
+	Cached     bool   `json:"-"` // taken from Redis, DeepL characters were not spent
 }
 
-func (a *DeeplAPI) CallDeeplAPI(text []string) (string, error) {
-	const maxRetry = 3
+// TranslateOptions are the languages of a translation, e.g. EN to EN-GB, an empty source language is detected by DeepL.
+// Formality is one of default, more, less, prefer_more or prefer_less, empty keeps the DeepL default
+type TranslateOptions struct {
+	SourceLang string
+	TargetLang string
+	Formality  string
+	GlossaryID string // set by Translate from the glossary of the language pair
+}
+
+// Translate translates the texts and returns translations with the source language detected by DeepL
+// in the same order. Cached texts are taken from Redis and the rest are translated with DeepL requests
+// of maxDeeplTexts texts. The glossary of the language pair is applied; a glossary needs the source language,
+// so texts without one are translated again with the glossary of the language DeepL detected, if there is one
+func (a *DeeplAPI) Translate(ctx context.Context, texts []string, opts TranslateOptions) ([]Translation, error) {
+	glossaries, err := a.DBClient.GetGlossaryIDs(ctx)
+	if err != nil {
+		slog.Info("could not read glossaries", "err", err)
+	}
 
-	ctx := context.Background()
-	v, err := a.DBClient.GetTranslation(ctx, text)
-	if err == nil {
-		slog.Info("hit deeplapi cache", "key", a.DBClient.DeepLKey(text))
-		return v, nil
+	// Translations without a source language depend on all glossaries into the target language
+	target := baseLang(opts.TargetLang)
+	glossaryKey := ""
+	if opts.SourceLang != "" {
+		opts.GlossaryID = glossaries[db.GlossaryPair(baseLang(opts.SourceLang), target)]
+		glossaryKey = opts.GlossaryID
+	} else {
+		ids := make([]string, 0)
+		for pair, id := range glossaries {
+			if strings.HasSuffix(pair, ">"+target) {
+				ids = append(ids, id)
+			}
+		}
+		slices.Sort(ids)
+		glossaryKey = strings.Join(ids, ",")
 	}
 
-	body, err := json.Marshal(TranslationIn{Text: text, TargetLang: "RU"})
+	keys := make([]string, len(texts))
+	for i, text := range texts {
+		keys[i] = a.DBClient.DeepLKey(text, opts.SourceLang, opts.TargetLang, opts.Formality, glossaryKey)
+	}
+	cached, err := a.DBClient.GetTranslations(ctx, keys)
 	if err != nil {
-		return "", err
+		slog.Info("could not read cache", "err", err)
+		cached = make([]string, len(texts))
 	}
-	bodyReader := bytes.NewReader(body)
+	translations := make([]Translation, len(texts))
+	missing := make([]int, 0)
+	for i, v := range cached {
+		translations[i] = decodeCachedTranslation(v)
+		if translations[i].Text == "" && texts[i] != "" {
+			missing = append(missing, i)
+		}
+	}
+	slog.Info("deeplapi cache lookup", "texts", len(texts), "hits", len(texts)-len(missing))
 
-	req, err := http.NewRequest("POST", a.BaseURL+"/v2/translate", bodyReader)
+	if err := a.translateMissing(ctx, texts, missing, opts, translations); err != nil {
+		return nil, err
+	}
+
+	// Texts in a language with a glossary are translated again with the glossary and the detected language
+	withGlossary := make(map[string][]int)
+	if opts.SourceLang == "" {
+		for _, i := range missing {
+			source := baseLang(translations[i].SourceLang)
+			if _, ok := glossaries[db.GlossaryPair(source, target)]; ok {
+				withGlossary[source] = append(withGlossary[source], i)
+			}
+		}
+	}
+	for source, indexes := range withGlossary {
+		o := opts
+		o.SourceLang, o.GlossaryID = strings.ToUpper(source), glossaries[db.GlossaryPair(source, target)]
+		if err := a.translateMissing(ctx, texts, indexes, o, translations); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, i := range missing {
+		if data, err := json.Marshal(translations[i]); err == nil {
+			if err := a.DBClient.SetTranslation(ctx, keys[i], string(data)); err != nil {
+				slog.Info("could not write cache", "err", err)
+			}
+		}
+	}
+	return translations, nil
+}
+
+// translateMissing translates the texts at the indexes with requests of maxDeeplTexts texts
+// and stores the results in translations
+func (a *DeeplAPI) translateMissing(ctx context.Context, texts []string, indexes []int, o TranslateOptions, translations []Translation) error {
+	for chunk := range slices.Chunk(indexes, maxDeeplTexts) {
+		batch := make([]string, 0, len(chunk))
+		for _, i := range chunk {
+			batch = append(batch, texts[i])
+		}
+		translated, err := a.callAPI(ctx, TranslationIn{
+			Text:       batch,
+			SourceLang: o.SourceLang,
+			TargetLang: o.TargetLang,
+			Formality:  o.Formality,
+			GlossaryID: o.GlossaryID,
+		})
+		if err != nil {
+			return err
+		}
+		if len(translated) != len(batch) {
+			return fmt.Errorf("got %d translations for %d texts", len(translated), len(batch))
+		}
+		for j, i := range chunk {
+			translations[i] = *translated[j]
+		}
+	}
+	return nil
+}
+
+// TranslateText translates a single text, see Translate
+func (a *DeeplAPI) TranslateText(ctx context.Context, text string, opts TranslateOptions) (Translation, error) {
+	translations, err := a.Translate(ctx, []string{text}, opts)
+	if err != nil {
+		return Translation{}, err
+	}
+	return translations[0], nil
+}
+
+// decodeCachedTranslation reads a translation cached as JSON, older entries hold only the text
+func decodeCachedTranslation(v string) Translation {
+	var t Translation
+	if strings.HasPrefix(v, "{") && json.Unmarshal([]byte(v), &t) == nil {
+		t.Cached = t.Text != ""
+		return t
+	}
+	return Translation{Text: v, Cached: v != ""}
+}
+
+func (a *DeeplAPI) callAPI(ctx context.Context, in TranslationIn) ([]*Translation, error) {
+	const maxRetry = 3
+
+	body, err := json.Marshal(in)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Authorization", "DeepL-Auth-Key "+a.ApiKey)
 
 	for i := 1; i <= maxRetry; i++ {
-		resp, err := a.HttpClient.Do(req)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.BaseURL+"/v2/translate", bytes.NewReader(body))
 		if err != nil {
-			return "", err
+			return nil, err
 		}
-		defer resp.Body.Close()
+		req.Header.Add("Content-Type", "application/json")
+		req.Header.Add("Authorization", "DeepL-Auth-Key "+a.ApiKey)
 
-		body, err := io.ReadAll(resp.Body)
+		resp, err := a.HttpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		respBody, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 
 		if resp.StatusCode/100 == 2 {
 			var t TranslationOut
-			if err := json.Unmarshal(body, &t); err != nil {
-				return "", err
+			if err := json.Unmarshal(respBody, &t); err != nil {
+				return nil, err
 			}
-			if len(t.Translations) > 0 {
-				err := a.DBClient.SetTranslation(ctx, text, t.Translations[0].Text)
-				if err != nil {
-					slog.Info("could not write cache", "err", err)
-				}
-				return t.Translations[0].Text, nil
-			} else {
-				return "", fmt.Errorf("no translation")
+			if len(t.Translations) == 0 {
+				return nil, fmt.Errorf("no translation")
 			}
+			return t.Translations, nil
 		}
 
 		if i < maxRetry {
-			slog.Info("got error response from api, retrying in 5 seconds...", "retry-cnt", i, "status", resp.Status, "body", string(body))
+			slog.Info("got error response from api, retrying in 5 seconds...", "retry-cnt", i, "status", resp.Status, "body", string(respBody))
 			time.Sleep(5 * time.Second)
 		} else {
-			return "", fmt.Errorf("got error response from api: %s - %s", resp.Status, string(body))
+			return nil, fmt.Errorf("got error response from api: %s - %s", resp.Status, string(respBody))
 		}
 	}
 
-	return "", fmt.Errorf("max retries reached")
+	return nil, fmt.Errorf("max retries reached")
 }
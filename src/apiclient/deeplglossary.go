@@ -0,0 +1,182 @@
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/rahfar/familybot/src/db"
+)
+
+// DeeplGlossary is a glossary created in DeepL, its entries are kept in Redis
+type DeeplGlossary struct {
+	ID         string `json:"glossary_id"`
+	Name       string `json:"name"`
+	Ready      bool   `json:"ready"`
+	SourceLang string `json:"source_lang"`
+	TargetLang string `json:"target_lang"`
+	EntryCount int    `json:"entry_count"`
+}
+
+type glossaryIn struct {
+	Name          string `json:"name"`
+	SourceLang    string `json:"source_lang"`
+	TargetLang    string `json:"target_lang"`
+	Entries       string `json:"entries"`
+	EntriesFormat string `json:"entries_format"`
+}
+
+// ListGlossaries returns glossaries created in DeepL
+func (a *DeeplAPI) ListGlossaries(ctx context.Context) ([]DeeplGlossary, error) {
+	var out struct {
+		Glossaries []DeeplGlossary `json:"glossaries"`
+	}
+	err := a.request(ctx, http.MethodGet, "/v2/glossaries", nil, &out)
+	return out.Glossaries, err
+}
+
+// DeleteGlossary deletes a glossary in DeepL
+func (a *DeeplAPI) DeleteGlossary(ctx context.Context, glossaryID string) error {
+	return a.request(ctx, http.MethodDelete, "/v2/glossaries/"+glossaryID, nil, nil)
+}
+
+// glossaryNamePrefix marks glossaries created by the bot, other glossaries of the DeepL account are left alone
+const glossaryNamePrefix = "familybot "
+
+// SyncGlossary recreates the DeepL glossary of a language pair from its entries in Redis, DeepL glossaries
+// cannot be edited. The new glossary is created before the old one is deleted, so the pair keeps its glossary
+// if DeepL fails. The pair is left without a glossary if it has no entries
+func (a *DeeplAPI) SyncGlossary(ctx context.Context, pair string) error {
+	ids, err := a.DBClient.GetGlossaryIDs(ctx)
+	if err != nil {
+		return err
+	}
+	entries, err := a.DBClient.GetGlossaryEntries(ctx, pair)
+	if err != nil {
+		return err
+	}
+
+	newID := ""
+	if len(entries) > 0 {
+		terms := make([]string, 0, len(entries))
+		for term := range entries {
+			terms = append(terms, term)
+		}
+		slices.Sort(terms)
+		var tsv strings.Builder
+		for _, term := range terms {
+			tsv.WriteString(term + "\t" + entries[term] + "\n")
+		}
+
+		sourceLang, targetLang, _ := strings.Cut(pair, ">")
+		var glossary DeeplGlossary
+		err = a.request(ctx, http.MethodPost, "/v2/glossaries", glossaryIn{
+			Name:          glossaryNamePrefix + pair,
+			SourceLang:    sourceLang,
+			TargetLang:    targetLang,
+			Entries:       tsv.String(),
+			EntriesFormat: "tsv",
+		}, &glossary)
+		if err != nil {
+			return err
+		}
+		slog.Info("created deepl glossary", "pair", pair, "glossary_id", glossary.ID, "entries", glossary.EntryCount)
+		newID = glossary.ID
+	}
+	if err := a.DBClient.SetGlossaryID(ctx, pair, newID); err != nil {
+		return err
+	}
+
+	// A glossary that could not be deleted is cleaned up by SyncGlossaries
+	if oldID, ok := ids[pair]; ok {
+		if err := a.DeleteGlossary(ctx, oldID); err != nil {
+			slog.Warn("could not delete old deepl glossary", "pair", pair, "glossary_id", oldID, "err", err)
+		}
+	}
+	return nil
+}
+
+// SyncGlossaries recreates glossaries of all language pairs and deletes glossaries created by the bot
+// that are unknown to Redis
+func (a *DeeplAPI) SyncGlossaries(ctx context.Context) error {
+	pairs, err := a.DBClient.GetGlossaryPairs(ctx)
+	if err != nil {
+		return err
+	}
+	ids, err := a.DBClient.GetGlossaryIDs(ctx)
+	if err != nil {
+		return err
+	}
+	for pair := range ids {
+		if !slices.Contains(pairs, pair) {
+			pairs = append(pairs, pair)
+		}
+	}
+	for _, pair := range pairs {
+		if err := a.SyncGlossary(ctx, pair); err != nil {
+			return fmt.Errorf("sync glossary %s: %w", pair, err)
+		}
+	}
+
+	glossaries, err := a.ListGlossaries(ctx)
+	if err != nil {
+		return err
+	}
+	ids, err = a.DBClient.GetGlossaryIDs(ctx)
+	if err != nil {
+		return err
+	}
+	for _, g := range glossaries {
+		if !strings.HasPrefix(g.Name, glossaryNamePrefix) {
+			continue
+		}
+		if ids[db.GlossaryPair(g.SourceLang, g.TargetLang)] != g.ID {
+			slog.Info("deleting unknown deepl glossary", "glossary_id", g.ID, "name", g.Name)
+			if err := a.DeleteGlossary(ctx, g.ID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (a *DeeplAPI) request(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, a.BaseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Authorization", "DeepL-Auth-Key "+a.ApiKey)
+
+	resp, err := a.HttpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("got error response from api: %s - %s", resp.Status, string(respBody))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(respBody, out)
+}
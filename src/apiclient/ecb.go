@@ -0,0 +1,117 @@
+package apiclient
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/rahfar/familybot/src/db"
+)
+
+// ECBProvider gets euro foreign exchange reference rates of the European Central Bank
+type ECBProvider struct {
+	HttpClient *http.Client
+	DBClient   *db.Client
+}
+
+type ecbEnvelope struct {
+	Cube struct {
+		Days []struct {
+			Time  string `xml:"time,attr"`
+			Rates []struct {
+				Currency string  `xml:"currency,attr"`
+				Rate     float64 `xml:"rate,attr"`
+			} `xml:"Cube"`
+		} `xml:"Cube"`
+	} `xml:"Cube"`
+}
+
+func (e *ECBProvider) Name() string {
+	return "ecb"
+}
+
+func (e *ECBProvider) Latest() (*ExchangeRates, error) {
+	return e.callAPI("eurofxref-daily.xml", time.Now().UTC(), time.Hour)
+}
+
+// Historical returns rates of the last working day on or before the date, only the last 90 days are available
+func (e *ECBProvider) Historical(date time.Time) (*ExchangeRates, error) {
+	return e.callAPI("eurofxref-hist-90d.xml", date, 12*time.Hour)
+}
+
+// parseECBRates returns rates per one EUR of the last day on or before the date
+func parseECBRates(data []byte, date time.Time) (*ExchangeRates, error) {
+	var envelope ecbEnvelope
+	if err := xml.Unmarshal(data, &envelope); err != nil {
+		return nil, err
+	}
+	// Days are sorted from the newest
+	for _, day := range envelope.Cube.Days {
+		t, err := time.Parse("2006-01-02", day.Time)
+		if err != nil || t.After(date) {
+			continue
+		}
+		xr := &ExchangeRates{Data: map[string]Rate{"EUR": {Code: "EUR", Value: 1}}}
+		xr.Meta.Update_time = t
+		for _, r := range day.Rates {
+			xr.Data[r.Currency] = Rate{Code: r.Currency, Value: r.Rate}
+		}
+		return xr, nil
+	}
+	return nil, fmt.Errorf("no ecb rates for %s", date.Format("2006-01-02"))
+}
+
+func (e *ECBProvider) callAPI(file string, date time.Time, ttl time.Duration) (*ExchangeRates, error) {
+	const maxRetry = 3
+	ctx := context.Background()
+	url := "https://www.ecb.europa.eu/stats/eurofxref/" + file
+	// Documents are cached for the day they were fetched on
+	cacheKey, cacheDate := e.Name()+"_"+file, time.Now().UTC()
+
+	v, err := e.DBClient.GetRatesData(ctx, cacheKey, cacheDate)
+	if err == nil {
+		slog.Info("hit ecb cache", "key", e.DBClient.RatesKey(cacheKey, cacheDate))
+		if xr, err := parseECBRates([]byte(v), date); err == nil {
+			xr.Source = e.Name()
+			return xr, nil
+		}
+	}
+
+	for i := 1; i <= maxRetry; i++ {
+		resp, err := e.HttpClient.Get(url)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode/100 == 2 {
+			if err := e.DBClient.SetRatesData(ctx, cacheKey, cacheDate, body, ttl); err != nil {
+				slog.Info("could not write cache", "err", err)
+			}
+			xr, err := parseECBRates(body, date)
+			if err != nil {
+				return nil, err
+			}
+			xr.Source = e.Name()
+			return xr, nil
+		}
+
+		if i < maxRetry {
+			slog.Info("got error response from api, retrying in 5 seconds...", "retry-cnt", i, "status", resp.Status)
+			time.Sleep(5 * time.Second)
+		} else {
+			return nil, fmt.Errorf("got error response from api: %s", resp.Status)
+		}
+	}
+
+	return nil, fmt.Errorf("max retries reached")
+}
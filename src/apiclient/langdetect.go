@@ -0,0 +1,132 @@
+package apiclient
+
+import (
+	"strings"
+	"unicode"
+)
+
+// LanguageNames are English names of languages by ISO 639-1 code, used in LLM prompts
+var LanguageNames = map[string]string{
+	"ar": "Arabic", "be": "Belarusian", "bg": "Bulgarian", "cs": "Czech", "da": "Danish",
+	"de": "German", "el": "Greek", "en": "English", "es": "Spanish", "et": "Estonian",
+	"fi": "Finnish", "fr": "French", "he": "Hebrew", "hu": "Hungarian", "hy": "Armenian",
+	"id": "Indonesian", "it": "Italian", "ja": "Japanese", "ka": "Georgian", "kk": "Kazakh",
+	"ko": "Korean", "lt": "Lithuanian", "lv": "Latvian", "nb": "Norwegian", "nl": "Dutch",
+	"pl": "Polish", "pt": "Portuguese", "ro": "Romanian", "ru": "Russian", "sk": "Slovak",
+	"sl": "Slovenian", "sv": "Swedish", "tr": "Turkish", "tt": "Tatar", "uk": "Ukrainian",
+	"zh": "Chinese",
+}
+
+// latinStopWords are frequent short words that tell apart languages written in Latin script
+var latinStopWords = map[string][]string{
+	"en": {"the", "and", "is", "are", "of", "to", "in", "you", "that", "it", "with", "for", "this", "was", "have", "what"},
+	"fi": {"ja", "on", "ei", "että", "se", "hän", "mutta", "kun", "minä", "sinä", "olen", "oli", "ovat", "tämä", "mitä", "kanssa", "myös", "vain", "kiitos", "hyvää"},
+	"de": {"und", "der", "die", "das", "ist", "nicht", "ich", "du", "ein", "eine", "mit", "auf", "zu", "wir", "es", "sind"},
+	"fr": {"le", "la", "les", "et", "est", "un", "une", "des", "je", "pas", "que", "pour", "dans", "vous", "avec", "sur"},
+	"es": {"el", "la", "los", "las", "y", "es", "un", "una", "que", "no", "por", "para", "con", "está", "pero", "muy"},
+	"it": {"il", "la", "e", "è", "di", "che", "non", "un", "una", "per", "sono", "con", "mi", "ma", "gli"},
+	"tr": {"ve", "bir", "bu", "da", "de", "ne", "için", "çok", "ben", "sen", "var", "yok", "mi", "değil", "ama"},
+}
+
+// latinLetters are letters specific to one of the languages in latinStopWords
+var latinLetters = map[string]string{
+	"fi": "äö",
+	"de": "ßüäö",
+	"fr": "çœêèàù",
+	"es": "ñ¿¡",
+	"it": "ìò",
+	"tr": "ğışç",
+}
+
+// DetectLanguage guesses the language of the text by its script, letters and frequent words.
+// It returns an ISO 639-1 code like ru or fi, or an empty string if the language is not recognized
+func DetectLanguage(text string) string {
+	text = strings.ToLower(text)
+	scripts := make(map[*unicode.RangeTable]int)
+	for _, r := range text {
+		for _, script := range []*unicode.RangeTable{
+			unicode.Cyrillic, unicode.Latin, unicode.Arabic, unicode.Greek, unicode.Hebrew,
+			unicode.Hangul, unicode.Hiragana, unicode.Katakana, unicode.Han, unicode.Georgian, unicode.Armenian,
+		} {
+			if unicode.Is(script, r) {
+				scripts[script]++
+				break
+			}
+		}
+	}
+
+	var script *unicode.RangeTable
+	for s, n := range scripts {
+		if script == nil || n > scripts[script] {
+			script = s
+		}
+	}
+	switch script {
+	case nil:
+		return ""
+	case unicode.Cyrillic:
+		return detectCyrillic(text)
+	case unicode.Latin:
+		return detectLatin(text)
+	case unicode.Arabic:
+		return "ar"
+	case unicode.Greek:
+		return "el"
+	case unicode.Hebrew:
+		return "he"
+	case unicode.Hangul:
+		return "ko"
+	case unicode.Georgian:
+		return "ka"
+	case unicode.Armenian:
+		return "hy"
+	case unicode.Han:
+		// Japanese mixes kanji with kana
+		if scripts[unicode.Hiragana]+scripts[unicode.Katakana] > 0 {
+			return "ja"
+		}
+		return "zh"
+	}
+	return "ja"
+}
+
+// detectCyrillic tells languages apart by letters that Russian does not have
+func detectCyrillic(text string) string {
+	switch {
+	case strings.ContainsAny(text, "ғқұ"):
+		return "kk"
+	case strings.ContainsAny(text, "әөүҗңһ"):
+		return "tt"
+	case strings.ContainsAny(text, "їєґ"):
+		return "uk"
+	case strings.ContainsRune(text, 'ў'):
+		return "be"
+	case strings.ContainsRune(text, 'і'):
+		return "uk"
+	}
+	return "ru"
+}
+
+// detectLatin scores languages by frequent words and specific letters
+func detectLatin(text string) string {
+	words := strings.FieldsFunc(text, func(r rune) bool { return !unicode.IsLetter(r) })
+	best, bestScore := "", 0
+	// Languages are checked in a fixed order, so ties are resolved the same way every time
+	for _, lang := range []string{"en", "fi", "de", "fr", "es", "it", "tr"} {
+		score := 0
+		for _, w := range words {
+			for _, stop := range latinStopWords[lang] {
+				if w == stop {
+					score += 2
+				}
+			}
+		}
+		for _, r := range latinLetters[lang] {
+			score += strings.Count(text, string(r))
+		}
+		if score > bestScore {
+			best, bestScore = lang, score
+		}
+	}
+	return best
+}
@@ -1,39 +1,264 @@
 package apiclient
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
-	miniflux "miniflux.app/client"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/rahfar/familybot/src/db"
+	"github.com/rahfar/familybot/src/metrics"
 )
 
+// minifluxFeedsTTL is how long the feed index is reused before it is downloaded again
+const minifluxFeedsTTL = 30 * time.Minute
+
+// MinifluxAPI is a client of the Miniflux REST API, it keeps an index of feeds between calls
 type MinifluxAPI struct {
-	BaseURL string
-	ApiKey  string
+	HttpClient *http.Client
+	BaseURL    string
+	ApiKey     string
+
+	mu        sync.Mutex
+	feeds     []NewsFeed
+	feedsTime time.Time
+}
+
+func (m *MinifluxAPI) Name() string {
+	return "miniflux"
+}
+
+type minifluxEntries struct {
+	Total   int         `json:"total"`
+	Entries []NewsEntry `json:"entries"`
 }
 
-func (m *MinifluxAPI) GetLatestNews(source string, cnt int) (miniflux.Entries, error) {
-	client := miniflux.New(m.BaseURL, m.ApiKey)
+// call sends a request to the Miniflux API and decodes the JSON response into out if it is not nil
+func (m *MinifluxAPI) call(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(m.BaseURL, "/")+"/v1"+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Auth-Token", m.ApiKey)
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	start := time.Now()
+	resp, err := m.HttpClient.Do(req)
+	if err != nil {
+		metrics.MinifluxRequestCounter.With(prometheus.Labels{"status": "error"}).Inc()
+		return err
+	}
+	defer resp.Body.Close()
+	metrics.MinifluxRequestCounter.With(prometheus.Labels{"status": strconv.Itoa(resp.StatusCode)}).Inc()
+	metrics.MinifluxRequestDuration.Observe(time.Since(start).Seconds())
 
-	// Fetch all feeds.
-	feeds, err := client.Feeds()
+	data, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return miniflux.Entries{}, err
+		return err
 	}
-	var myFeed *miniflux.Feed
-	for _, f := range feeds {
-		if strings.HasPrefix(f.SiteURL, source) {
-			myFeed = f
-			break
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("got error response from miniflux: %s - %s", resp.Status, string(data))
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// Feeds returns all feeds, the index is downloaded again after minifluxFeedsTTL
+func (m *MinifluxAPI) Feeds(ctx context.Context) ([]NewsFeed, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.feeds != nil && time.Since(m.feedsTime) < minifluxFeedsTTL {
+		metrics.NewsFeedCacheCounter.With(prometheus.Labels{"result": "hit"}).Inc()
+		return m.feeds, nil
+	}
+	metrics.NewsFeedCacheCounter.With(prometheus.Labels{"result": "miss"}).Inc()
+
+	var feeds []NewsFeed
+	if err := m.call(ctx, http.MethodGet, "/feeds", nil, &feeds); err != nil {
+		return nil, err
+	}
+	sort.Slice(feeds, func(i, j int) bool { return feeds[i].ID < feeds[j].ID })
+	m.feeds, m.feedsTime = feeds, time.Now()
+	return feeds, nil
+}
+
+// InvalidateFeeds drops the feed index so the next call downloads it again
+func (m *MinifluxAPI) InvalidateFeeds() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.feeds = nil
+}
+
+// FindFeed looks up a feed by the prefix of its site or feed URL, the index is refreshed once on a miss
+// because the feed may have been added after it was downloaded
+func (m *MinifluxAPI) FindFeed(ctx context.Context, source string) (*NewsFeed, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		feeds, err := m.Feeds(ctx)
+		if err != nil {
+			return nil, err
 		}
+		for i, f := range feeds {
+			if strings.HasPrefix(f.SiteURL, source) || strings.HasPrefix(f.FeedURL, source) {
+				return &feeds[i], nil
+			}
+		}
+		m.InvalidateFeeds()
 	}
-	if myFeed != nil {
-		entries, err := client.Entries(&miniflux.Filter{FeedID: myFeed.ID, Limit: cnt, Order: "published_at", Direction: "desc"})
+	return nil, fmt.Errorf("no feed for %s", source)
+}
+
+// ResolveSource returns the API path listing entries of the source by feed ID, category ID or site URL, in this order,
+// an empty source lists entries of all feeds
+func (m *MinifluxAPI) ResolveSource(ctx context.Context, source db.NewsSource) (string, error) {
+	switch {
+	case source.FeedID > 0:
+		return fmt.Sprintf("/feeds/%d/entries", source.FeedID), nil
+	case source.CategoryID > 0:
+		return fmt.Sprintf("/categories/%d/entries", source.CategoryID), nil
+	case source.SiteURL != "":
+		feed, err := m.FindFeed(ctx, source.SiteURL)
 		if err != nil {
-			return miniflux.Entries{}, err
+			return "", err
 		}
-		return entries.Entries, nil
-	} else {
-		return miniflux.Entries{}, fmt.Errorf("no feed")
+		return fmt.Sprintf("/feeds/%d/entries", feed.ID), nil
 	}
+	return "/entries", nil
+}
+
+func (m *MinifluxAPI) getEntries(ctx context.Context, source db.NewsSource, filter url.Values) ([]NewsEntry, error) {
+	path, err := m.ResolveSource(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	var entries minifluxEntries
+	if err := m.call(ctx, http.MethodGet, path+"?"+filter.Encode(), nil, &entries); err != nil {
+		return nil, err
+	}
+	slog.Debug("got miniflux entries", "path", path, "total", entries.Total, "count", len(entries.Entries))
+	return entries.Entries, nil
+}
+
+func (m *MinifluxAPI) GetLatestNews(ctx context.Context, source db.NewsSource) ([]NewsEntry, error) {
+	return m.getEntries(ctx, source, url.Values{
+		"limit":     {strconv.Itoa(source.Count)},
+		"order":     {"published_at"},
+		"direction": {"desc"},
+	})
+}
+
+// GetUnreadNews returns the newest entries of the source that are not read yet
+func (m *MinifluxAPI) GetUnreadNews(ctx context.Context, source db.NewsSource) ([]NewsEntry, error) {
+	return m.getEntries(ctx, source, url.Values{
+		"status":    {"unread"},
+		"limit":     {strconv.Itoa(source.Count)},
+		"order":     {"published_at"},
+		"direction": {"desc"},
+	})
+}
+
+// GetMostReadNews returns entries published after since that were read in Miniflux,
+// starred entries go first
+func (m *MinifluxAPI) GetMostReadNews(ctx context.Context, source db.NewsSource, since time.Time) ([]NewsEntry, error) {
+	entries, err := m.getEntries(ctx, source, url.Values{
+		"status":    {"read"},
+		"after":     {strconv.FormatInt(since.Unix(), 10)},
+		"order":     {"published_at"},
+		"direction": {"desc"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Starred && !entries[j].Starred
+	})
+	if len(entries) > source.Count {
+		entries = entries[:source.Count]
+	}
+	return entries, nil
+}
+
+// GetEntriesAfter returns up to limit entries of the source with IDs greater than afterID, oldest first
+func (m *MinifluxAPI) GetEntriesAfter(ctx context.Context, source db.NewsSource, afterID int64, limit int) ([]NewsEntry, error) {
+	return m.getEntries(ctx, source, url.Values{
+		"after_entry_id": {strconv.FormatInt(afterID, 10)},
+		"limit":          {strconv.Itoa(limit)},
+		"order":          {"id"},
+		"direction":      {"asc"},
+	})
+}
+
+// GetLastEntryID returns the ID of the newest entry of the source, 0 if it has no entries
+func (m *MinifluxAPI) GetLastEntryID(ctx context.Context, source db.NewsSource) (int64, error) {
+	entries, err := m.getEntries(ctx, source, url.Values{
+		"limit":     {"1"},
+		"order":     {"id"},
+		"direction": {"desc"},
+	})
+	if err != nil || len(entries) == 0 {
+		return 0, err
+	}
+	return entries[0].ID, nil
+}
+
+// GetUnreadPage returns a page of unread entries of the source, newest first, and the number of unread entries
+func (m *MinifluxAPI) GetUnreadPage(ctx context.Context, source db.NewsSource, offset, limit int) ([]NewsEntry, int, error) {
+	path, err := m.ResolveSource(ctx, source)
+	if err != nil {
+		return nil, 0, err
+	}
+	filter := url.Values{
+		"status":    {"unread"},
+		"offset":    {strconv.Itoa(offset)},
+		"limit":     {strconv.Itoa(limit)},
+		"order":     {"published_at"},
+		"direction": {"desc"},
+	}
+	var entries minifluxEntries
+	if err := m.call(ctx, http.MethodGet, path+"?"+filter.Encode(), nil, &entries); err != nil {
+		return nil, 0, err
+	}
+	return entries.Entries, entries.Total, nil
+}
+
+// GetEntry returns a single entry with its content
+func (m *MinifluxAPI) GetEntry(ctx context.Context, entryID int64) (*NewsEntry, error) {
+	var entry NewsEntry
+	if err := m.call(ctx, http.MethodGet, fmt.Sprintf("/entries/%d", entryID), nil, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// SetEntriesStatus marks entries as read or unread, the status is shared with the Miniflux web UI
+func (m *MinifluxAPI) SetEntriesStatus(ctx context.Context, entryIDs []int64, status string) error {
+	return m.call(ctx, http.MethodPut, "/entries", map[string]any{"entry_ids": entryIDs, "status": status}, nil)
+}
+
+// ToggleStar stars the entry or removes the star
+func (m *MinifluxAPI) ToggleStar(ctx context.Context, entryID int64) error {
+	return m.call(ctx, http.MethodPut, fmt.Sprintf("/entries/%d/bookmark", entryID), nil, nil)
 }
@@ -0,0 +1,71 @@
+package apiclient
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/rahfar/familybot/src/db"
+)
+
+// NewsProvider is a source of news feeds and their entries for the digest, /news and subscriptions.
+// Sources select entries by feed ID, category ID or site URL, an empty source selects all feeds
+type NewsProvider interface {
+	Name() string
+	// Feeds returns all feeds with their categories
+	Feeds(ctx context.Context) ([]NewsFeed, error)
+	// InvalidateFeeds drops the cached list of feeds
+	InvalidateFeeds()
+	// FindFeed looks up a feed by the prefix of its site or feed URL
+	FindFeed(ctx context.Context, source string) (*NewsFeed, error)
+
+	GetLatestNews(ctx context.Context, source db.NewsSource) ([]NewsEntry, error)
+	GetUnreadNews(ctx context.Context, source db.NewsSource) ([]NewsEntry, error)
+	GetMostReadNews(ctx context.Context, source db.NewsSource, since time.Time) ([]NewsEntry, error)
+	GetUnreadPage(ctx context.Context, source db.NewsSource, offset, limit int) ([]NewsEntry, int, error)
+	// GetEntriesAfter returns entries that appeared after the entry with afterID, oldest first
+	GetEntriesAfter(ctx context.Context, source db.NewsSource, afterID int64, limit int) ([]NewsEntry, error)
+	GetLastEntryID(ctx context.Context, source db.NewsSource) (int64, error)
+	GetEntry(ctx context.Context, entryID int64) (*NewsEntry, error)
+
+	// SetEntriesStatus marks entries as read or unread
+	SetEntriesStatus(ctx context.Context, entryIDs []int64, status string) error
+	ToggleStar(ctx context.Context, entryID int64) error
+}
+
+type NewsCategory struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+}
+
+type NewsFeed struct {
+	ID       int64         `json:"id"`
+	Title    string        `json:"title"`
+	SiteURL  string        `json:"site_url"`
+	FeedURL  string        `json:"feed_url"`
+	Category *NewsCategory `json:"category"`
+}
+
+type NewsEntry struct {
+	ID          int64     `json:"id"`
+	FeedID      int64     `json:"feed_id"`
+	Status      string    `json:"status"` // unread or read
+	Title       string    `json:"title"`
+	URL         string    `json:"url"`
+	Content     string    `json:"content"`
+	Starred     bool      `json:"starred"`
+	PublishedAt time.Time `json:"published_at"`
+	Feed        *NewsFeed `json:"feed"`
+}
+
+// NewNewsProvider creates the news provider by name: miniflux or rss, the feeds file is used by rss only
+func NewNewsProvider(provider, minifluxURL, minifluxKey, feedsFile string, httpClient *http.Client, dbClient *db.Client) NewsProvider {
+	if provider == "rss" {
+		return NewRSSProvider(feedsFile, httpClient, dbClient)
+	}
+	if provider != "miniflux" {
+		slog.Warn("unknown news provider, using default", "provider", provider, "default", "miniflux")
+	}
+	return &MinifluxAPI{HttpClient: httpClient, BaseURL: minifluxURL, ApiKey: minifluxKey}
+}
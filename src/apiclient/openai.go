@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strings"
 	"time"
 
 	openai "github.com/sashabaranov/go-openai"
@@ -130,26 +131,48 @@ func (o *OpenaiAPI) CorrectGrammarAndStyle(text string) (string, error) {
 	return o.requestChatCompletion(messages, "gpt-5-nano")
 }
 
-func (o *OpenaiAPI) TranslateEnglishToRussian(text string) (string, error) {
-	prompt := "translate from english to russian: " + text
+// TranslateText translates the text between languages given as ISO 639-1 codes, the source language
+// is left to the model if it is empty
+func (o *OpenaiAPI) TranslateText(text, sourceLang, targetLang string) (string, error) {
+	gptcontext := "Translate the following text into " + languageName(targetLang)
+	if sourceLang != "" {
+		gptcontext = "Translate the following text from " + languageName(sourceLang) + " into " + languageName(targetLang)
+	}
+	gptcontext += ". Keep names, emoji and formatting. Return only the translation."
 
-	if len(prompt) > MaxPromptSymbolSize {
-		return "Слишком длинный вопрос, попробуйте покороче", nil
+	if len(text) > MaxPromptSymbolSize {
+		return "Слишком длинный текст, попробуйте покороче", nil
 	}
 
-	messages := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: prompt}}
+	messages := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: gptcontext},
+		{Role: openai.ChatMessageRoleUser, Content: text},
+	}
 
 	return o.requestChatCompletion(messages, "gpt-5-nano")
 }
 
-func (o *OpenaiAPI) TranslateRussianToEnglish(text string) (string, error) {
-	prompt := "переведи с русского на английский: " + text
+func languageName(lang string) string {
+	if name, ok := LanguageNames[baseLang(lang)]; ok {
+		return name
+	}
+	return lang
+}
+
+// SummarizeText retells the article in 2-3 sentences in Russian
+func (o *OpenaiAPI) SummarizeText(title, text string) (string, error) {
+	gptcontext := "Summarize the following news article in 2-3 sentences in Russian. " +
+		"Keep the key facts, names and numbers, do not add anything that is not in the article. " +
+		"Return only the summary."
 
-	if len(prompt) > MaxPromptSymbolSize {
-		return "Слишком длинный вопрос, попробуйте покороче", nil
+	if len(text) > MaxPromptSymbolSize {
+		text = strings.ToValidUTF8(text[:MaxPromptSymbolSize], "")
 	}
 
-	messages := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: prompt}}
+	messages := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: gptcontext},
+		{Role: openai.ChatMessageRoleUser, Content: title + "\n\n" + text},
+	}
 
 	return o.requestChatCompletion(messages, "gpt-5-nano")
 }
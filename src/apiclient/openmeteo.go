@@ -0,0 +1,303 @@
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/rahfar/familybot/src/db"
+)
+
+// OpenMeteoProvider gets forecasts from the Open-Meteo API which doesn't need an API key
+type OpenMeteoProvider struct {
+	HttpClient *http.Client
+	DBClient   *db.Client
+}
+
+type openMeteoResponse struct {
+	UtcOffsetSeconds int `json:"utc_offset_seconds"`
+	Current          struct {
+		Time                int64   `json:"time"`
+		Temperature         float64 `json:"temperature_2m"`
+		ApparentTemperature float64 `json:"apparent_temperature"`
+		Humidity            int     `json:"relative_humidity_2m"`
+		Precipitation       float64 `json:"precipitation"`
+		WeatherCode         int     `json:"weather_code"`
+		WindSpeed           float64 `json:"wind_speed_10m"`
+		WindGusts           float64 `json:"wind_gusts_10m"`
+		IsDay               int     `json:"is_day"`
+	} `json:"current"`
+	Hourly struct {
+		Time                     []int64   `json:"time"`
+		Temperature              []float64 `json:"temperature_2m"`
+		ApparentTemperature      []float64 `json:"apparent_temperature"`
+		Humidity                 []int     `json:"relative_humidity_2m"`
+		PrecipitationProbability []float64 `json:"precipitation_probability"`
+		Precipitation            []float64 `json:"precipitation"`
+		WeatherCode              []int     `json:"weather_code"`
+		WindSpeed                []float64 `json:"wind_speed_10m"`
+		WindGusts                []float64 `json:"wind_gusts_10m"`
+		IsDay                    []int     `json:"is_day"`
+	} `json:"hourly"`
+	Daily struct {
+		Time    []int64 `json:"time"`
+		Sunrise []int64 `json:"sunrise"`
+		Sunset  []int64 `json:"sunset"`
+	} `json:"daily"`
+}
+
+type openMeteoGeocodingResponse struct {
+	Results []struct {
+		Name        string  `json:"name"`
+		Latitude    float64 `json:"latitude"`
+		Longitude   float64 `json:"longitude"`
+		CountryCode string  `json:"country_code"`
+		Admin1      string  `json:"admin1"`
+	} `json:"results"`
+}
+
+// wmoConditions maps WMO weather interpretation codes used by Open-Meteo to conditions
+var wmoConditions = map[int]Condition{
+	0:  {ConditionClear, "ясно"},
+	1:  {ConditionClear, "преимущественно ясно"},
+	2:  {ConditionClouds, "переменная облачность"},
+	3:  {ConditionClouds, "пасмурно"},
+	45: {ConditionFog, "туман"},
+	48: {ConditionFog, "изморозь"},
+	51: {ConditionDrizzle, "слабая морось"},
+	53: {ConditionDrizzle, "морось"},
+	55: {ConditionDrizzle, "сильная морось"},
+	56: {ConditionFreezingRain, "ледяная морось"},
+	57: {ConditionFreezingRain, "сильная ледяная морось"},
+	61: {ConditionRain, "небольшой дождь"},
+	63: {ConditionRain, "дождь"},
+	65: {ConditionHeavyRain, "сильный дождь"},
+	66: {ConditionFreezingRain, "ледяной дождь"},
+	67: {ConditionFreezingRain, "сильный ледяной дождь"},
+	71: {ConditionSnow, "небольшой снег"},
+	73: {ConditionSnow, "снег"},
+	75: {ConditionHeavySnow, "сильный снег"},
+	77: {ConditionSnow, "снежная крупа"},
+	80: {ConditionRain, "небольшой ливень"},
+	81: {ConditionRain, "ливень"},
+	82: {ConditionHeavyRain, "сильный ливень"},
+	85: {ConditionSnow, "небольшой снегопад"},
+	86: {ConditionHeavySnow, "сильный снегопад"},
+	95: {ConditionThunderstorm, "гроза"},
+	96: {ConditionThunderstorm, "гроза с градом"},
+	99: {ConditionThunderstorm, "гроза с сильным градом"},
+}
+
+func (o *OpenMeteoProvider) Name() string {
+	return "openmeteo"
+}
+
+// Forecast returns the forecast for the given coordinates, hourly data is grouped into 3-hour steps
+func (o *OpenMeteoProvider) Forecast(lat, lon float64) (*Forecast, error) {
+	data, err := o.callForecastAPI(lat, lon)
+	if err != nil {
+		return nil, err
+	}
+
+	forecast := &Forecast{
+		Place:          Place{Lat: lat, Lon: lon},
+		TimezoneOffset: data.UtcOffsetSeconds,
+		Current: ForecastItem{
+			Time:          time.Unix(data.Current.Time, 0),
+			Temp:          data.Current.Temperature,
+			FeelsLike:     data.Current.ApparentTemperature,
+			Humidity:      data.Current.Humidity,
+			WindSpeed:     data.Current.WindSpeed,
+			WindGust:      data.Current.WindGusts,
+			Precipitation: data.Current.Precipitation,
+			Condition:     wmoConditions[data.Current.WeatherCode],
+			Daytime:       data.Current.IsDay == 1,
+		},
+		Items:    make([]ForecastItem, 0),
+		Provider: o.Name(),
+	}
+	if len(data.Daily.Sunrise) > 0 && len(data.Daily.Sunset) > 0 {
+		forecast.Sunrise = time.Unix(data.Daily.Sunrise[0], 0)
+		forecast.Sunset = time.Unix(data.Daily.Sunset[0], 0)
+	}
+
+	h := data.Hourly
+	n := min(len(h.Time), len(h.Temperature), len(h.ApparentTemperature), len(h.Humidity),
+		len(h.PrecipitationProbability), len(h.Precipitation), len(h.WeatherCode),
+		len(h.WindSpeed), len(h.WindGusts), len(h.IsDay))
+	location := forecast.Location()
+	currentStep := threeHourStep(forecast.Current.Time.In(location))
+	for i := 0; i < n; i++ {
+		t := time.Unix(h.Time[i], 0).In(location)
+		step := threeHourStep(t)
+		if step.Before(currentStep) {
+			continue
+		}
+
+		condition := wmoConditions[h.WeatherCode[i]]
+		last := len(forecast.Items) - 1
+		if last < 0 || !forecast.Items[last].Time.Equal(step) {
+			forecast.Items = append(forecast.Items, ForecastItem{
+				Time:      step,
+				Temp:      h.Temperature[i],
+				FeelsLike: h.ApparentTemperature[i],
+				Humidity:  h.Humidity[i],
+				WindSpeed: h.WindSpeed[i],
+				Condition: condition,
+				Daytime:   h.IsDay[i] == 1,
+			})
+			last++
+		}
+
+		item := &forecast.Items[last]
+		item.Precipitation += h.Precipitation[i]
+		item.Pop = max(item.Pop, h.PrecipitationProbability[i]/100)
+		item.WindGust = max(item.WindGust, h.WindGusts[i])
+		// The most severe condition within the step describes it
+		if condition.Kind > item.Condition.Kind {
+			item.Condition = condition
+		}
+	}
+	if len(forecast.Items) == 0 {
+		return nil, fmt.Errorf("empty forecast")
+	}
+
+	return forecast, nil
+}
+
+// Geocode resolves a place name with the Open-Meteo geocoding API, names are returned in Russian
+func (o *OpenMeteoProvider) Geocode(query string) ([]GeoLocation, error) {
+	data, err := o.callGeocodingAPI(query)
+	if err != nil {
+		return nil, err
+	}
+	locations := make([]GeoLocation, 0, len(data.Results))
+	for _, r := range data.Results {
+		locations = append(locations, GeoLocation{
+			Name:    r.Name,
+			Lat:     r.Latitude,
+			Lon:     r.Longitude,
+			Country: r.CountryCode,
+			State:   r.Admin1,
+		})
+	}
+	return locations, nil
+}
+
+// ReverseGeocode is not supported, Open-Meteo has no reverse geocoding API
+func (o *OpenMeteoProvider) ReverseGeocode(lat, lon float64) ([]GeoLocation, error) {
+	return nil, fmt.Errorf("reverse geocoding: %w", errors.ErrUnsupported)
+}
+
+// threeHourStep truncates the local time to the beginning of its 3-hour step
+func threeHourStep(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour()/3*3, 0, 0, 0, t.Location())
+}
+
+func (o *OpenMeteoProvider) callForecastAPI(lat, lon float64) (*openMeteoResponse, error) {
+	const maxRetry = 3
+	var data openMeteoResponse
+	ctx := context.Background()
+	baseURL := "https://api.open-meteo.com/v1/forecast"
+	queryStr := fmt.Sprintf(
+		"?latitude=%f&longitude=%f&timezone=auto&timeformat=unixtime&wind_speed_unit=ms&forecast_days=7"+
+			"&current=temperature_2m,apparent_temperature,relative_humidity_2m,precipitation,weather_code,wind_speed_10m,wind_gusts_10m,is_day"+
+			"&hourly=temperature_2m,apparent_temperature,relative_humidity_2m,precipitation_probability,precipitation,weather_code,wind_speed_10m,wind_gusts_10m,is_day"+
+			"&daily=sunrise,sunset",
+		lat, lon,
+	)
+
+	v, err := o.DBClient.GetOpenMeteoData(ctx, lat, lon)
+	if err == nil {
+		slog.Info("hit openmeteo cache", "key", o.DBClient.OpenMeteoKey(lat, lon))
+		err := json.Unmarshal([]byte(v), &data)
+		if err == nil {
+			return &data, nil
+		}
+	}
+
+	for i := 1; i <= maxRetry; i++ {
+		resp, err := o.HttpClient.Get(baseURL + queryStr)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return nil, fmt.Errorf("%w: %s - %s", ErrQuotaExceeded, resp.Status, string(body))
+		}
+
+		if resp.StatusCode/100 == 2 {
+			err := o.DBClient.SetOpenMeteoData(ctx, lat, lon, body)
+			if err != nil {
+				slog.Info("could not write cache", "err", err)
+			}
+			err = json.Unmarshal(body, &data)
+			if err != nil {
+				return nil, err
+			}
+			return &data, nil
+		}
+
+		if i < maxRetry {
+			slog.Info("got error response from api, retrying in 5 seconds...", "retry-cnt", i, "status", resp.Status, "body", string(body))
+			time.Sleep(5 * time.Second)
+		} else {
+			return nil, fmt.Errorf("got error response from api: %s - %s", resp.Status, string(body))
+		}
+	}
+
+	return nil, fmt.Errorf("max retries reached")
+}
+
+func (o *OpenMeteoProvider) callGeocodingAPI(query string) (*openMeteoGeocodingResponse, error) {
+	const maxRetry = 3
+	var data openMeteoGeocodingResponse
+	baseURL := "https://geocoding-api.open-meteo.com/v1/search"
+	queryStr := fmt.Sprintf("?name=%s&count=5&language=ru&format=json", url.QueryEscape(query))
+
+	for i := 1; i <= maxRetry; i++ {
+		resp, err := o.HttpClient.Get(baseURL + queryStr)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return nil, fmt.Errorf("%w: %s - %s", ErrQuotaExceeded, resp.Status, string(body))
+		}
+
+		if resp.StatusCode/100 == 2 {
+			err = json.Unmarshal(body, &data)
+			if err != nil {
+				return nil, err
+			}
+			return &data, nil
+		}
+
+		if i < maxRetry {
+			slog.Info("got error response from api, retrying in 5 seconds...", "retry-cnt", i, "status", resp.Status, "body", string(body))
+			time.Sleep(5 * time.Second)
+		} else {
+			return nil, fmt.Errorf("got error response from api: %s - %s", resp.Status, string(body))
+		}
+	}
+
+	return nil, fmt.Errorf("max retries reached")
+}
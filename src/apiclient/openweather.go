@@ -0,0 +1,288 @@
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/rahfar/familybot/src/db"
+)
+
+// OpenWeatherProvider gets forecasts from the OpenWeather 5 day / 3 hour forecast API
+type OpenWeatherProvider struct {
+	ApiKey     string
+	HttpClient *http.Client
+	DBClient   *db.Client
+}
+
+// Root struct represents the entire JSON response
+type WeatherResponse struct {
+	Cod     string        `json:"cod"`
+	Message int           `json:"message"`
+	Cnt     int           `json:"cnt"`
+	List    []WeatherItem `json:"list"`
+	City    City          `json:"city"`
+}
+
+// WeatherItem struct represents each item in the 'list' array
+type WeatherItem struct {
+	Dt         int64     `json:"dt"`
+	Main       Main      `json:"main"`
+	Weather    []Weather `json:"weather"`
+	Clouds     Clouds    `json:"clouds"`
+	Wind       Wind      `json:"wind"`
+	Visibility int       `json:"visibility"`
+	Pop        float64   `json:"pop"`
+	Rain       Volume    `json:"rain"`
+	Snow       Volume    `json:"snow"`
+	Sys        Sys       `json:"sys"`
+	DtTxt      string    `json:"dt_txt"`
+}
+
+// Main struct contains details on temperature and pressure
+type Main struct {
+	Temp      float64 `json:"temp"`
+	FeelsLike float64 `json:"feels_like"`
+	TempMin   float64 `json:"temp_min"`
+	TempMax   float64 `json:"temp_max"`
+	Pressure  int     `json:"pressure"`
+	SeaLevel  int     `json:"sea_level"`
+	GrndLevel int     `json:"grnd_level"`
+	Humidity  int     `json:"humidity"`
+	TempKf    float64 `json:"temp_kf"`
+}
+
+// Weather struct provides weather summary and icon
+type Weather struct {
+	ID          int    `json:"id"`
+	Main        string `json:"main"`
+	Description string `json:"description"`
+	Icon        string `json:"icon"`
+}
+
+// Clouds struct provides cloudiness percentage
+type Clouds struct {
+	All int `json:"all"`
+}
+
+// Wind struct contains information about wind speed and direction
+type Wind struct {
+	Speed float64 `json:"speed"`
+	Deg   int     `json:"deg"`
+	Gust  float64 `json:"gust"`
+}
+
+// Volume struct contains precipitation volume for the last 3 hours, mm
+type Volume struct {
+	ThreeHours float64 `json:"3h"`
+}
+
+// Sys struct provides part of day information
+type Sys struct {
+	Pod string `json:"pod"`
+}
+
+// City struct contains city information
+type City struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	Coord      Coord  `json:"coord"`
+	Country    string `json:"country"`
+	Population int    `json:"population"`
+	Timezone   int    `json:"timezone"`
+	Sunrise    int64  `json:"sunrise"`
+	Sunset     int64  `json:"sunset"`
+}
+
+// Coord struct provides geographical coordinates of the city
+type Coord struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+func (w *OpenWeatherProvider) Name() string {
+	return "openweather"
+}
+
+// Forecast returns the forecast for the given coordinates converted to the provider-neutral model
+func (w *OpenWeatherProvider) Forecast(lat, lon float64) (*Forecast, error) {
+	weather, err := w.callForecastAPI(lat, lon)
+	if err != nil {
+		return nil, err
+	}
+	if len(weather.List) == 0 {
+		return nil, fmt.Errorf("empty forecast")
+	}
+
+	forecast := &Forecast{
+		Place:          Place{Name: weather.City.Name, Lat: lat, Lon: lon},
+		TimezoneOffset: weather.City.Timezone,
+		Sunrise:        time.Unix(weather.City.Sunrise, 0),
+		Sunset:         time.Unix(weather.City.Sunset, 0),
+		Items:          make([]ForecastItem, 0, len(weather.List)),
+		Provider:       w.Name(),
+	}
+	for _, item := range weather.List {
+		forecast.Items = append(forecast.Items, item.toForecastItem())
+	}
+	// The nearest forecast item is used as current conditions
+	forecast.Current = forecast.Items[0]
+	return forecast, nil
+}
+
+// Geocode resolves a place name with the OpenWeather geocoding API
+func (w *OpenWeatherProvider) Geocode(query string) ([]GeoLocation, error) {
+	return w.callGeocodingAPI(fmt.Sprintf("/direct?q=%s&limit=5&appid=%s", url.QueryEscape(query), w.ApiKey))
+}
+
+// ReverseGeocode finds the nearest named place with the OpenWeather geocoding API
+func (w *OpenWeatherProvider) ReverseGeocode(lat, lon float64) ([]GeoLocation, error) {
+	return w.callGeocodingAPI(fmt.Sprintf("/reverse?lat=%f&lon=%f&limit=1&appid=%s", lat, lon, w.ApiKey))
+}
+
+func (item WeatherItem) toForecastItem() ForecastItem {
+	result := ForecastItem{
+		Time:          time.Unix(item.Dt, 0),
+		Temp:          item.Main.Temp,
+		FeelsLike:     item.Main.FeelsLike,
+		Humidity:      item.Main.Humidity,
+		WindSpeed:     item.Wind.Speed,
+		WindGust:      item.Wind.Gust,
+		Pop:           item.Pop,
+		Precipitation: item.Rain.ThreeHours + item.Snow.ThreeHours,
+		Daytime:       item.Sys.Pod == "d",
+	}
+	if len(item.Weather) > 0 {
+		result.Condition = Condition{
+			Kind:        openWeatherConditionKind(item.Weather[0].ID),
+			Description: item.Weather[0].Description,
+		}
+	}
+	return result
+}
+
+// openWeatherConditionKind maps OpenWeather condition codes to provider-neutral kinds
+func openWeatherConditionKind(id int) ConditionKind {
+	switch {
+	case id >= 200 && id < 300:
+		return ConditionThunderstorm
+	case id >= 300 && id < 400:
+		return ConditionDrizzle
+	case id == 511:
+		return ConditionFreezingRain
+	case id == 502 || id == 503 || id == 504 || id == 522 || id == 531:
+		return ConditionHeavyRain
+	case id >= 500 && id < 600:
+		return ConditionRain
+	case id == 602 || id == 622:
+		return ConditionHeavySnow
+	case id >= 600 && id < 700:
+		return ConditionSnow
+	case id >= 700 && id < 800:
+		return ConditionFog
+	case id == 800:
+		return ConditionClear
+	default:
+		return ConditionClouds
+	}
+}
+
+func (w *OpenWeatherProvider) callForecastAPI(lat, lon float64) (*WeatherResponse, error) {
+	const maxRetry = 3
+	var weather WeatherResponse
+	ctx := context.Background()
+	baseURL := "https://api.openweathermap.org/data/2.5/forecast"
+	queryStr := fmt.Sprintf("?lat=%f&lon=%f&appid=%s&lang=ru&units=metric", lat, lon, w.ApiKey)
+
+	v, err := w.DBClient.GetWeatherData(ctx, lat, lon)
+	if err == nil {
+		slog.Info("hit weatherapi cache", "key", w.DBClient.WeatherKey(lat, lon))
+		err := json.Unmarshal([]byte(v), &weather)
+		if err == nil {
+			return &weather, nil
+		}
+	}
+
+	for i := 1; i <= maxRetry; i++ {
+		resp, err := w.HttpClient.Get(baseURL + queryStr)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return nil, fmt.Errorf("%w: %s - %s", ErrQuotaExceeded, resp.Status, string(body))
+		}
+
+		if resp.StatusCode/100 == 2 {
+			err := w.DBClient.SetWeatherData(ctx, lat, lon, body)
+			if err != nil {
+				slog.Info("could not write cache", "err", err)
+			}
+			err = json.Unmarshal(body, &weather)
+			if err != nil {
+				return nil, err
+			}
+			return &weather, nil
+		}
+
+		if i < maxRetry {
+			slog.Info("got error response from api, retrying in 5 seconds...", "retry-cnt", i, "status", resp.Status, "body", string(body))
+			time.Sleep(5 * time.Second)
+		} else {
+			return nil, fmt.Errorf("got error response from api: %s - %s", resp.Status, string(body))
+		}
+	}
+
+	return nil, fmt.Errorf("max retries reached")
+}
+
+func (w *OpenWeatherProvider) callGeocodingAPI(pathAndQuery string) ([]GeoLocation, error) {
+	const maxRetry = 3
+	baseURL := "https://api.openweathermap.org/geo/1.0"
+
+	for i := 1; i <= maxRetry; i++ {
+		resp, err := w.HttpClient.Get(baseURL + pathAndQuery)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return nil, fmt.Errorf("%w: %s - %s", ErrQuotaExceeded, resp.Status, string(body))
+		}
+
+		if resp.StatusCode/100 == 2 {
+			var locations []GeoLocation
+			err = json.Unmarshal(body, &locations)
+			if err != nil {
+				return nil, err
+			}
+			return locations, nil
+		}
+
+		if i < maxRetry {
+			slog.Info("got error response from api, retrying in 5 seconds...", "retry-cnt", i, "status", resp.Status, "body", string(body))
+			time.Sleep(5 * time.Second)
+		} else {
+			return nil, fmt.Errorf("got error response from api: %s - %s", resp.Status, string(body))
+		}
+	}
+
+	return nil, fmt.Errorf("max retries reached")
+}
@@ -0,0 +1,19 @@
+package apiclient
+
+import "time"
+
+// RatesProvider is a source of exchange rates, rates of all currencies are against the provider's base currency
+type RatesProvider interface {
+	Name() string
+	Latest() (*ExchangeRates, error)
+	// Historical returns rates on the given UTC date
+	Historical(date time.Time) (*ExchangeRates, error)
+}
+
+// Quote is the rate of a currency pair with its source
+type Quote struct {
+	Rate   float64
+	Source string
+	// Time is when the provider updated the rate
+	Time time.Time
+}
@@ -0,0 +1,581 @@
+package apiclient
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rahfar/familybot/src/db"
+)
+
+const (
+	defaultRSSInterval = 30 * time.Minute
+	minRSSInterval     = 5 * time.Minute
+	maxFeedSize        = 5 << 20
+)
+
+// RSSConfig is the list of feeds of the built-in RSS provider, IDs are referenced by news sources
+// and subscriptions, so they must not change
+type RSSConfig struct {
+	Categories []NewsCategory `json:"categories"`
+	Feeds      []struct {
+		ID         int64  `json:"id"`
+		Title      string `json:"title"`
+		URL        string `json:"url"`
+		SiteURL    string `json:"site_url"`
+		CategoryID int64  `json:"category_id"`
+		Interval   string `json:"interval"` // how often the feed is fetched, e.g. 15m, default 30m
+	} `json:"feeds"`
+}
+
+type rssFeed struct {
+	NewsFeed
+	Interval time.Duration
+}
+
+// RSSProvider fetches RSS 2.0 and Atom 1.0 feeds itself and keeps entries and their read state in Redis.
+// Feeds are fetched on demand when their interval has passed, with conditional GETs
+type RSSProvider struct {
+	HttpClient *http.Client
+	DBClient   *db.Client
+
+	feeds []rssFeed
+	// mu serializes fetches so a feed is not fetched twice by concurrent requests
+	mu sync.Mutex
+}
+
+// NewRSSProvider creates the provider with feeds from the config file
+func NewRSSProvider(feedsFile string, httpClient *http.Client, dbClient *db.Client) *RSSProvider {
+	r := &RSSProvider{HttpClient: httpClient, DBClient: dbClient}
+	data, err := os.ReadFile(feedsFile)
+	if err != nil {
+		slog.Warn("Error reading news feeds file", "err", err)
+		return r
+	}
+	var cfg RSSConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		slog.Warn("Error parsing news feeds file", "err", err)
+		return r
+	}
+
+	categories := make(map[int64]*NewsCategory)
+	for i := range cfg.Categories {
+		categories[cfg.Categories[i].ID] = &cfg.Categories[i]
+	}
+	for _, f := range cfg.Feeds {
+		if f.ID <= 0 || f.URL == "" {
+			slog.Warn("skip news feed without id or url", "feed", f.Title)
+			continue
+		}
+		feed := rssFeed{
+			NewsFeed: NewsFeed{ID: f.ID, Title: f.Title, SiteURL: f.SiteURL, FeedURL: f.URL, Category: categories[f.CategoryID]},
+			Interval: defaultRSSInterval,
+		}
+		if feed.SiteURL == "" {
+			if u, err := url.Parse(f.URL); err == nil {
+				feed.SiteURL = u.Scheme + "://" + u.Host
+			}
+		}
+		if f.Interval != "" {
+			interval, err := time.ParseDuration(f.Interval)
+			if err != nil {
+				slog.Warn("invalid news feed interval, using default", "feed", f.Title, "interval", f.Interval)
+			} else {
+				feed.Interval = max(interval, minRSSInterval)
+			}
+		}
+		r.feeds = append(r.feeds, feed)
+	}
+	return r
+}
+
+func (r *RSSProvider) Name() string {
+	return "rss"
+}
+
+func (r *RSSProvider) Feeds(ctx context.Context) ([]NewsFeed, error) {
+	feeds := make([]NewsFeed, 0, len(r.feeds))
+	for _, f := range r.feeds {
+		feeds = append(feeds, f.NewsFeed)
+	}
+	return feeds, nil
+}
+
+// InvalidateFeeds does nothing, the feeds come from the config file
+func (r *RSSProvider) InvalidateFeeds() {}
+
+func (r *RSSProvider) FindFeed(ctx context.Context, source string) (*NewsFeed, error) {
+	for i, f := range r.feeds {
+		if strings.HasPrefix(f.SiteURL, source) || strings.HasPrefix(f.FeedURL, source) {
+			return &r.feeds[i].NewsFeed, nil
+		}
+	}
+	return nil, fmt.Errorf("no feed for %s", source)
+}
+
+func (r *RSSProvider) selectFeeds(source db.NewsSource) ([]rssFeed, error) {
+	switch {
+	case source.FeedID > 0:
+		i := slices.IndexFunc(r.feeds, func(f rssFeed) bool { return f.ID == source.FeedID })
+		if i < 0 {
+			return nil, fmt.Errorf("no feed %d", source.FeedID)
+		}
+		return r.feeds[i : i+1], nil
+	case source.CategoryID > 0:
+		feeds := make([]rssFeed, 0)
+		for _, f := range r.feeds {
+			if f.Category != nil && f.Category.ID == source.CategoryID {
+				feeds = append(feeds, f)
+			}
+		}
+		if len(feeds) == 0 {
+			return nil, fmt.Errorf("no feeds in category %d", source.CategoryID)
+		}
+		return feeds, nil
+	case source.SiteURL != "":
+		feed, err := r.FindFeed(context.Background(), source.SiteURL)
+		if err != nil {
+			return nil, err
+		}
+		return r.selectFeeds(db.NewsSource{FeedID: feed.ID})
+	}
+	return r.feeds, nil
+}
+
+// refresh fetches feeds whose interval has passed, failed feeds keep their stored entries
+func (r *RSSProvider) refresh(ctx context.Context, feeds []rssFeed) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, f := range feeds {
+		state, err := r.DBClient.GetRSSFeedState(ctx, f.ID)
+		if err != nil {
+			slog.Error("error getting rss feed state", "err", err, "feed", f.Title)
+			continue
+		}
+		if time.Since(state.FetchedAt) < f.Interval {
+			continue
+		}
+		if err := r.fetch(ctx, f, state); err != nil {
+			slog.Warn("could not fetch rss feed", "err", err, "feed", f.Title)
+		}
+	}
+}
+
+func (r *RSSProvider) fetch(ctx context.Context, f rssFeed, state db.RSSFeedState) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.FeedURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; familybot)")
+	if state.ETag != "" {
+		req.Header.Set("If-None-Match", state.ETag)
+	}
+	if state.LastModified != "" {
+		req.Header.Set("If-Modified-Since", state.LastModified)
+	}
+
+	resp, err := r.HttpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		slog.Debug("rss feed is not modified", "feed", f.Title)
+		state.FetchedAt = time.Now()
+		return r.DBClient.SetRSSFeedState(ctx, f.ID, state)
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("got error response from %s: %s", f.FeedURL, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxFeedSize))
+	if err != nil {
+		return err
+	}
+	items, err := parseFeed(body)
+	if err != nil {
+		return err
+	}
+
+	// Feeds list the newest items first, older items get lower entry IDs
+	added := 0
+	for i := len(items) - 1; i >= 0; i-- {
+		item := items[i]
+		id, isNew, err := r.DBClient.RSSEntryID(ctx, f.ID, item.GUID)
+		if err != nil {
+			return err
+		}
+		if !isNew {
+			continue
+		}
+		entry := NewsEntry{
+			ID:          id,
+			FeedID:      f.ID,
+			Status:      "unread",
+			Title:       item.Title,
+			URL:         item.Link,
+			Content:     item.Content,
+			PublishedAt: item.Published,
+		}
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		if err := r.DBClient.AddRSSEntry(ctx, f.ID, id, data); err != nil {
+			return err
+		}
+		added++
+	}
+	slog.Info("fetched rss feed", "feed", f.Title, "items", len(items), "new", added)
+
+	state = db.RSSFeedState{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		FetchedAt:    time.Now(),
+	}
+	return r.DBClient.SetRSSFeedState(ctx, f.ID, state)
+}
+
+// entries returns stored entries of the source after fetching its feeds if they are due
+func (r *RSSProvider) entries(ctx context.Context, source db.NewsSource) ([]NewsEntry, error) {
+	feeds, err := r.selectFeeds(source)
+	if err != nil {
+		return nil, err
+	}
+	r.refresh(ctx, feeds)
+
+	ids := make([]int64, 0)
+	for _, f := range feeds {
+		feedIDs, err := r.DBClient.GetRSSEntryIDs(ctx, f.ID)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, feedIDs...)
+	}
+	return r.load(ctx, ids)
+}
+
+func (r *RSSProvider) load(ctx context.Context, ids []int64) ([]NewsEntry, error) {
+	values, err := r.DBClient.GetRSSEntries(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]NewsEntry, 0, len(values))
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		var e NewsEntry
+		if err := json.Unmarshal([]byte(v), &e); err != nil {
+			return nil, err
+		}
+		if i := slices.IndexFunc(r.feeds, func(f rssFeed) bool { return f.ID == e.FeedID }); i >= 0 {
+			e.Feed = &r.feeds[i].NewsFeed
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// filterNews keeps entries matching the filter, newest publications first
+func filterNews(entries []NewsEntry, keep func(e NewsEntry) bool) []NewsEntry {
+	entries = slices.DeleteFunc(entries, func(e NewsEntry) bool { return !keep(e) })
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].PublishedAt.After(entries[j].PublishedAt) })
+	return entries
+}
+
+func (r *RSSProvider) GetLatestNews(ctx context.Context, source db.NewsSource) ([]NewsEntry, error) {
+	entries, err := r.entries(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	entries = filterNews(entries, func(e NewsEntry) bool { return true })
+	return entries[:min(len(entries), source.Count)], nil
+}
+
+// GetUnreadNews returns the newest entries of the source that are not read yet
+func (r *RSSProvider) GetUnreadNews(ctx context.Context, source db.NewsSource) ([]NewsEntry, error) {
+	entries, err := r.entries(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	entries = filterNews(entries, func(e NewsEntry) bool { return e.Status == "unread" })
+	return entries[:min(len(entries), source.Count)], nil
+}
+
+// GetMostReadNews returns entries published after since that were read, starred entries go first
+func (r *RSSProvider) GetMostReadNews(ctx context.Context, source db.NewsSource, since time.Time) ([]NewsEntry, error) {
+	entries, err := r.entries(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	entries = filterNews(entries, func(e NewsEntry) bool { return e.Status == "read" && e.PublishedAt.After(since) })
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Starred && !entries[j].Starred
+	})
+	return entries[:min(len(entries), source.Count)], nil
+}
+
+func (r *RSSProvider) GetUnreadPage(ctx context.Context, source db.NewsSource, offset, limit int) ([]NewsEntry, int, error) {
+	entries, err := r.entries(ctx, source)
+	if err != nil {
+		return nil, 0, err
+	}
+	entries = filterNews(entries, func(e NewsEntry) bool { return e.Status == "unread" })
+	if offset >= len(entries) {
+		return nil, len(entries), nil
+	}
+	return entries[offset:min(len(entries), offset+limit)], len(entries), nil
+}
+
+func (r *RSSProvider) GetEntriesAfter(ctx context.Context, source db.NewsSource, afterID int64, limit int) ([]NewsEntry, error) {
+	entries, err := r.entries(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	entries = slices.DeleteFunc(entries, func(e NewsEntry) bool { return e.ID <= afterID })
+	slices.SortFunc(entries, func(a, b NewsEntry) int { return cmp.Compare(a.ID, b.ID) })
+	return entries[:min(len(entries), limit)], nil
+}
+
+func (r *RSSProvider) GetLastEntryID(ctx context.Context, source db.NewsSource) (int64, error) {
+	entries, err := r.entries(ctx, source)
+	if err != nil {
+		return 0, err
+	}
+	var last int64
+	for _, e := range entries {
+		last = max(last, e.ID)
+	}
+	return last, nil
+}
+
+func (r *RSSProvider) GetEntry(ctx context.Context, entryID int64) (*NewsEntry, error) {
+	entries, err := r.load(ctx, []int64{entryID})
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no entry %d", entryID)
+	}
+	return &entries[0], nil
+}
+
+func (r *RSSProvider) SetEntriesStatus(ctx context.Context, entryIDs []int64, status string) error {
+	return r.update(ctx, entryIDs, func(e *NewsEntry) { e.Status = status })
+}
+
+func (r *RSSProvider) ToggleStar(ctx context.Context, entryID int64) error {
+	return r.update(ctx, []int64{entryID}, func(e *NewsEntry) { e.Starred = !e.Starred })
+}
+
+func (r *RSSProvider) update(ctx context.Context, entryIDs []int64, change func(e *NewsEntry)) error {
+	entries, err := r.load(ctx, entryIDs)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		change(&e)
+		e.Feed = nil
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if err := r.DBClient.UpdateRSSEntry(ctx, e.ID, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// feedItem is an item of an RSS or Atom feed
+type feedItem struct {
+	GUID      string
+	Title     string
+	Link      string
+	Content   string
+	Published time.Time
+}
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	GUID        string `xml:"guid"`
+	Description string `xml:"description"`
+	Content     string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	PubDate     string `xml:"pubDate"`
+	Date        string `xml:"http://purl.org/dc/elements/1.1/ date"`
+}
+
+type atomEntry struct {
+	Title string `xml:"title"`
+	ID    string `xml:"id"`
+	Links []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+	} `xml:"link"`
+	Summary   string `xml:"summary"`
+	Content   string `xml:"content"`
+	Published string `xml:"published"`
+	Updated   string `xml:"updated"`
+}
+
+// feedDocument matches RSS 2.0 (items in the channel), RSS 1.0 (items in the root) and Atom 1.0 (entries)
+type feedDocument struct {
+	Channel struct {
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+	Items   []rssItem   `xml:"item"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// feedDateFormats are layouts of RFC 822 dates seen in RSS feeds and of RFC 3339 dates of Atom
+var feedDateFormats = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+}
+
+func parseFeedDate(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range feedDateFormats {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Now()
+}
+
+// koi8r maps bytes 0x80-0xFF of KOI8-R to runes
+var koi8r = [128]rune{
+	'─', '│', '┌', '┐', '└', '┘', '├', '┤', '┬', '┴', '┼', '▀', '▄', '█', '▌', '▐',
+	'░', '▒', '▓', '⌠', '■', '∙', '√', '≈', '≤', '≥', '\u00a0', '⌡', '°', '²', '·', '÷',
+	'═', '║', '╒', 'ё', '╓', '╔', '╕', '╖', '╗', '╘', '╙', '╚', '╛', '╜', '╝', '╞',
+	'╟', '╠', '╡', 'Ё', '╢', '╣', '╤', '╥', '╦', '╧', '╨', '╩', '╪', '╫', '╬', '©',
+	'ю', 'а', 'б', 'ц', 'д', 'е', 'ф', 'г', 'х', 'и', 'й', 'к', 'л', 'м', 'н', 'о',
+	'п', 'я', 'р', 'с', 'т', 'у', 'ж', 'в', 'ь', 'ы', 'з', 'ш', 'э', 'щ', 'ч', 'ъ',
+	'Ю', 'А', 'Б', 'Ц', 'Д', 'Е', 'Ф', 'Г', 'Х', 'И', 'Й', 'К', 'Л', 'М', 'Н', 'О',
+	'П', 'Я', 'Р', 'С', 'Т', 'У', 'Ж', 'В', 'Ь', 'Ы', 'З', 'Ш', 'Э', 'Щ', 'Ч', 'Ъ',
+}
+
+// iso88591 maps bytes 0x80-0xFF of ISO-8859-1 to runes, they are the same code points
+var iso88591 = func() (table [128]rune) {
+	for i := range table {
+		table[i] = rune(0x80 + i)
+	}
+	return table
+}()
+
+// windows1252 maps bytes 0x80-0xFF of windows-1252, it differs from ISO-8859-1 only in 0x80-0x9F
+var windows1252 = func() [128]rune {
+	table := iso88591
+	copy(table[:32], []rune{
+		'€', '�', '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', '�', 'Ž', '�',
+		'�', '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', '�', 'ž', 'Ÿ',
+	})
+	return table
+}()
+
+// feedCharsetReader is an xml.Decoder CharsetReader for feeds in single-byte encodings. Feeds with
+// an unknown charset are read as UTF-8, since many of them declare a charset they are not encoded in
+func feedCharsetReader(charset string, input io.Reader) (io.Reader, error) {
+	body, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	var table *[128]rune
+	switch strings.ToLower(charset) {
+	case "windows-1251", "cp1251":
+		table = &windows1251
+	case "koi8-r":
+		table = &koi8r
+	case "iso-8859-1", "iso_8859-1", "latin1", "latin-1", "l1":
+		table = &iso88591
+	case "windows-1252", "cp1252":
+		table = &windows1252
+	default:
+		slog.Info("unsupported feed charset, reading as utf-8", "charset", charset)
+		return strings.NewReader(strings.ToValidUTF8(string(body), "")), nil
+	}
+
+	var sb strings.Builder
+	sb.Grow(len(body) * 2)
+	for _, c := range body {
+		if c < 0x80 {
+			sb.WriteByte(c)
+		} else {
+			sb.WriteRune(table[c-0x80])
+		}
+	}
+	return strings.NewReader(sb.String()), nil
+}
+
+// parseFeed parses an RSS or Atom document into items in the document order
+func parseFeed(data []byte) ([]feedItem, error) {
+	var doc feedDocument
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = feedCharsetReader
+	decoder.Strict = false
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	items := make([]feedItem, 0)
+	for _, i := range append(doc.Channel.Items, doc.Items...) {
+		item := feedItem{
+			GUID:      firstNonEmpty(i.GUID, i.Link, i.Title),
+			Title:     HTMLToText(i.Title),
+			Link:      strings.TrimSpace(i.Link),
+			Content:   firstNonEmpty(i.Content, i.Description),
+			Published: parseFeedDate(firstNonEmpty(i.PubDate, i.Date)),
+		}
+		items = append(items, item)
+	}
+	for _, e := range doc.Entries {
+		link := ""
+		for _, l := range e.Links {
+			if l.Rel == "" || l.Rel == "alternate" {
+				link = l.Href
+				break
+			}
+		}
+		item := feedItem{
+			GUID:      firstNonEmpty(e.ID, link, e.Title),
+			Title:     HTMLToText(e.Title),
+			Link:      link,
+			Content:   firstNonEmpty(e.Content, e.Summary),
+			Published: parseFeedDate(firstNonEmpty(e.Published, e.Updated)),
+		}
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("no items in feed")
+	}
+	return items, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
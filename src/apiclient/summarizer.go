@@ -0,0 +1,218 @@
+package apiclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rahfar/familybot/src/db"
+)
+
+const (
+	// minEntryContentSize is the length of entry content below which the article is fetched from its URL,
+	// feeds often publish only a teaser
+	minEntryContentSize = 500
+	maxPageSize         = 2 << 20
+	// minParagraphSize filters out captions, bylines and other short blocks of a page
+	minParagraphSize = 60
+)
+
+var (
+	// skipBlocksRe matches blocks that never contain the article text
+	skipBlocksRe = regexp.MustCompile(`(?is)<script\b.*?</script\s*>|<style\b.*?</style\s*>|<noscript\b.*?</noscript\s*>|` +
+		`<nav\b.*?</nav\s*>|<header\b.*?</header\s*>|<footer\b.*?</footer\s*>|<aside\b.*?</aside\s*>|` +
+		`<form\b.*?</form\s*>|<svg\b.*?</svg\s*>|<!--.*?-->`)
+	articleRe   = regexp.MustCompile(`(?is)<article\b[^>]*>(.*?)</article\s*>`)
+	paragraphRe = regexp.MustCompile(`(?is)<p\b[^>]*>(.*?)</p\s*>`)
+	titleRe     = regexp.MustCompile(`(?is)<title\b[^>]*>(.*?)</title\s*>`)
+	htmlTagRe   = regexp.MustCompile(`(?s)<[^>]*>`)
+)
+
+// Summarizer retells news articles in a few sentences, summaries are cached per entry and URL.
+// Pages are fetched by URLs from chat messages and feeds, so HttpClient should be made with NewPublicHTTPClient
+type Summarizer struct {
+	HttpClient *http.Client
+	DBClient   *db.Client
+	OpenaiAPI  *OpenaiAPI
+	// NewsProvider is the name of the provider of summarized entries, entry IDs of miniflux and rss overlap
+	NewsProvider string
+}
+
+// SummarizeEntry summarizes the news entry, its page is fetched if the feed only has a teaser
+func (s *Summarizer) SummarizeEntry(ctx context.Context, e NewsEntry) (string, error) {
+	if v, err := s.DBClient.GetEntrySummary(ctx, s.NewsProvider, e.ID); err == nil {
+		slog.Info("hit summary cache", "entry_id", e.ID)
+		return v, nil
+	}
+
+	text := HTMLToText(e.Content)
+	if len(text) < minEntryContentSize && e.URL != "" {
+		if _, pageText, err := s.fetchArticle(ctx, e.URL); err != nil {
+			slog.Info("could not fetch article, using entry content", "url", e.URL, "err", err)
+		} else if len(pageText) > len(text) {
+			text = pageText
+		}
+	}
+	if text == "" {
+		return "", fmt.Errorf("entry %d has no text", e.ID)
+	}
+
+	summary, err := s.OpenaiAPI.SummarizeText(e.Title, text)
+	if err != nil {
+		return "", err
+	}
+	if err := s.DBClient.SetEntrySummary(ctx, s.NewsProvider, e.ID, summary); err != nil {
+		slog.Info("could not write cache", "err", err)
+	}
+	return summary, nil
+}
+
+// SummarizeURL fetches the page and summarizes its article
+func (s *Summarizer) SummarizeURL(ctx context.Context, url string) (string, error) {
+	if v, err := s.DBClient.GetURLSummary(ctx, url); err == nil {
+		slog.Info("hit summary cache", "key", s.DBClient.SummaryURLKey(url))
+		return v, nil
+	}
+
+	title, text, err := s.fetchArticle(ctx, url)
+	if err != nil {
+		return "", err
+	}
+	if text == "" {
+		return "", fmt.Errorf("no text on %s", url)
+	}
+
+	summary, err := s.OpenaiAPI.SummarizeText(title, text)
+	if err != nil {
+		return "", err
+	}
+	if err := s.DBClient.SetURLSummary(ctx, url, summary); err != nil {
+		slog.Info("could not write cache", "err", err)
+	}
+	return summary, nil
+}
+
+// NewPublicHTTPClient returns a client that only connects to public addresses over http and https,
+// so URLs sent to the bot cannot reach the bot's host or its local network
+func NewPublicHTTPClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 30 * time.Second,
+		// Addresses are checked after name resolution, so hosts resolving to private addresses are rejected too
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := addrPort.Addr().Unmap(); !isPublicAddr(ip) {
+				return fmt.Errorf("%w: %s", errPrivateAddress, ip)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return checkURLScheme(req.URL)
+		},
+	}
+}
+
+var errPrivateAddress = errors.New("address is not public")
+
+func isPublicAddr(ip netip.Addr) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !ip.IsLoopback() && !ip.IsLinkLocalUnicast()
+}
+
+func checkURLScheme(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported url scheme %q", u.Scheme)
+	}
+	return nil
+}
+
+func (s *Summarizer) fetchArticle(ctx context.Context, url string) (string, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", "", err
+	}
+	if err := checkURLScheme(req.URL); err != nil {
+		return "", "", err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; familybot)")
+	req.Header.Set("Accept", "text/html")
+
+	resp, err := s.HttpClient.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return "", "", fmt.Errorf("got error response from %s: %s", url, resp.Status)
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" && !strings.Contains(contentType, "html") {
+		return "", "", fmt.Errorf("unsupported content type %s", contentType)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPageSize))
+	if err != nil {
+		return "", "", err
+	}
+	title, text := ExtractArticle(strings.ToValidUTF8(string(body), ""))
+	return title, text, nil
+}
+
+// ExtractArticle finds the title and the readable text of an HTML page: paragraphs of the longest <article>
+// or of the whole page, the text of the page without markup is used when there are no paragraphs
+func ExtractArticle(page string) (string, string) {
+	title := ""
+	if m := titleRe.FindStringSubmatch(page); m != nil {
+		title = HTMLToText(m[1])
+	}
+
+	page = skipBlocksRe.ReplaceAllString(page, " ")
+	content := page
+	if articles := articleRe.FindAllStringSubmatch(page, -1); len(articles) > 0 {
+		content = ""
+		for _, m := range articles {
+			if len(m[1]) > len(content) {
+				content = m[1]
+			}
+		}
+	}
+
+	paragraphs := make([]string, 0)
+	for _, m := range paragraphRe.FindAllStringSubmatch(content, -1) {
+		if p := HTMLToText(m[1]); len(p) >= minParagraphSize {
+			paragraphs = append(paragraphs, p)
+		}
+	}
+	if len(paragraphs) == 0 {
+		return title, HTMLToText(content)
+	}
+	return title, strings.Join(paragraphs, "\n")
+}
+
+// HTMLToText strips tags and entities and collapses whitespace
+func HTMLToText(content string) string {
+	return strings.Join(strings.Fields(html.UnescapeString(htmlTagRe.ReplaceAllString(content, " "))), " ")
+}
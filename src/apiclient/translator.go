@@ -0,0 +1,96 @@
+package apiclient
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// deeplLanguages are languages DeepL translates from and to by ISO 639-1 code
+var deeplLanguages = []string{
+	"ar", "bg", "cs", "da", "de", "el", "en", "es", "et", "fi", "fr", "hu", "id", "it", "ja",
+	"ko", "lt", "lv", "nb", "nl", "pl", "pt", "ro", "ru", "sk", "sl", "sv", "tr", "uk", "zh",
+}
+
+// deeplTargets are DeepL target languages for codes that need a regional variant
+var deeplTargets = map[string]string{
+	"en": "EN-US",
+	"pt": "PT-BR",
+}
+
+// ErrSameLanguage is returned when the text is already in the target language
+var ErrSameLanguage = errors.New("text is already in the target language")
+
+// Translator translates texts between any languages, with DeepL when it supports both languages
+// and with the LLM otherwise or when DeepL fails
+type Translator struct {
+	DeeplAPI  *DeeplAPI
+	OpenaiAPI *OpenaiAPI
+}
+
+// TranslationResult is a translated text with its source language and the service that translated it
+type TranslationResult struct {
+	Text       string
+	SourceLang string // detected by DeepL if it was not given, empty if it is unknown
+	Provider   string // deepl or openai
+	Cached     bool   // the DeepL translation was cached and no characters were spent
+	// Provider and Cached are also set with ErrSameLanguage if DeepL was called to detect the language
+}
+
+// Translate translates the text into targetLang, the source language is detected if sourceLang is empty.
+// Languages are ISO 639-1 codes like ru, fi or tt, DeepL regional variants like en-gb are accepted as well
+func (t *Translator) Translate(ctx context.Context, text, sourceLang, targetLang string) (TranslationResult, error) {
+	sourceLang, targetLang = strings.ToLower(sourceLang), strings.ToLower(targetLang)
+	result := TranslationResult{SourceLang: sourceLang}
+	if sourceLang != "" && baseLang(sourceLang) == baseLang(targetLang) {
+		return result, ErrSameLanguage
+	}
+
+	// The local guess only picks the service: it cannot tell apart e.g. Russian and Bulgarian without
+	// specific letters, so DeepL detects the source language itself
+	guess := cmp.Or(sourceLang, DetectLanguage(text))
+	if DeeplSupports(targetLang) && (guess == "" || DeeplSupports(guess)) {
+		translation, err := t.DeeplAPI.TranslateText(ctx, text, TranslateOptions{
+			SourceLang: strings.ToUpper(baseLang(sourceLang)),
+			TargetLang: deeplTarget(targetLang),
+		})
+		if err == nil {
+			result.SourceLang = cmp.Or(sourceLang, strings.ToLower(translation.SourceLang))
+			result.Provider, result.Cached = "deepl", translation.Cached
+			if baseLang(result.SourceLang) == baseLang(targetLang) {
+				return result, ErrSameLanguage
+			}
+			result.Text = translation.Text
+			return result, nil
+		}
+		slog.Warn("could not translate with deepl, falling back to openai", "err", err)
+	}
+
+	translation, err := t.OpenaiAPI.TranslateText(text, sourceLang, targetLang)
+	if err != nil {
+		return result, err
+	}
+	result.Text, result.Provider = translation, "openai"
+	return result, nil
+}
+
+// DeeplSupports checks if DeepL translates from and to the language
+func DeeplSupports(lang string) bool {
+	return slices.Contains(deeplLanguages, baseLang(lang))
+}
+
+func deeplTarget(lang string) string {
+	if target, ok := deeplTargets[lang]; ok {
+		return target
+	}
+	return strings.ToUpper(lang)
+}
+
+// baseLang strips the region of a language code, e.g. en-gb becomes en
+func baseLang(lang string) string {
+	base, _, _ := strings.Cut(strings.ToLower(lang), "-")
+	return base
+}
@@ -3,25 +3,36 @@ package apiclient
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"os"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/rahfar/familybot/src/db"
 )
 
 type WeatherAPI struct {
-	ApiKey      string
-	Config      WeatherAPIConfig
-	HttpClient  *http.Client
-	DBClient *db.Client
+	ApiKey     string
+	Config     WeatherAPIConfig
+	HttpClient *http.Client
+	DBClient   *db.Client
+	// Providers are tried in order until one of them returns a forecast
+	Providers []WeatherProvider
 }
 
+// providerExhaustedTTL is how long a provider is skipped after it ran out of quota
+const providerExhaustedTTL = time.Hour
+
+// WeatherAPIConfig is the initial seed of weather cities, at runtime cities are stored in Redis
 type WeatherAPIConfig struct {
 	Cities map[string]CityPosition `json:"cities"`
+	// CityOrder keeps the order of cities in the config file
+	CityOrder []string `json:"-"`
 }
 
 type CityPosition struct {
@@ -29,82 +40,22 @@ type CityPosition struct {
 	Lon float64 `json:"lon"`
 }
 
-// Root struct represents the entire JSON response
-type WeatherResponse struct {
-	Cod     string        `json:"cod"`
-	Message int           `json:"message"`
-	Cnt     int           `json:"cnt"`
-	List    []WeatherItem `json:"list"`
-	City    City          `json:"city"`
-}
-
-// WeatherItem struct represents each item in the 'list' array
-type WeatherItem struct {
-	Dt         int64     `json:"dt"`
-	Main       Main      `json:"main"`
-	Weather    []Weather `json:"weather"`
-	Clouds     Clouds    `json:"clouds"`
-	Wind       Wind      `json:"wind"`
-	Visibility int       `json:"visibility"`
-	Pop        float64   `json:"pop"`
-	Sys        Sys       `json:"sys"`
-	DtTxt      string    `json:"dt_txt"`
-}
-
-// Main struct contains details on temperature and pressure
-type Main struct {
-	Temp      float64 `json:"temp"`
-	FeelsLike float64 `json:"feels_like"`
-	TempMin   float64 `json:"temp_min"`
-	TempMax   float64 `json:"temp_max"`
-	Pressure  int     `json:"pressure"`
-	SeaLevel  int     `json:"sea_level"`
-	GrndLevel int     `json:"grnd_level"`
-	Humidity  int     `json:"humidity"`
-	TempKf    float64 `json:"temp_kf"`
-}
-
-// Weather struct provides weather summary and icon
-type Weather struct {
-	ID          int    `json:"id"`
-	Main        string `json:"main"`
-	Description string `json:"description"`
-	Icon        string `json:"icon"`
-}
-
-// Clouds struct provides cloudiness percentage
-type Clouds struct {
-	All int `json:"all"`
-}
-
-// Wind struct contains information about wind speed and direction
-type Wind struct {
-	Speed float64 `json:"speed"`
-	Deg   int     `json:"deg"`
-	Gust  float64 `json:"gust"`
-}
-
-// Sys struct provides part of day information
-type Sys struct {
-	Pod string `json:"pod"`
-}
-
-// City struct contains city information
-type City struct {
-	ID         int    `json:"id"`
-	Name       string `json:"name"`
-	Coord      Coord  `json:"coord"`
-	Country    string `json:"country"`
-	Population int    `json:"population"`
-	Timezone   int    `json:"timezone"`
-	Sunrise    int64  `json:"sunrise"`
-	Sunset     int64  `json:"sunset"`
-}
-
-// Coord struct provides geographical coordinates of the city
-type Coord struct {
-	Lat float64 `json:"lat"`
-	Lon float64 `json:"lon"`
+// GeoLocation is a single result of the geocoding API
+type GeoLocation struct {
+	Name       string            `json:"name"`
+	LocalNames map[string]string `json:"local_names"`
+	Lat        float64           `json:"lat"`
+	Lon        float64           `json:"lon"`
+	Country    string            `json:"country"`
+	State      string            `json:"state"`
+}
+
+// LocalName returns the russian name of the location if it is known
+func (g GeoLocation) LocalName() string {
+	if name, ok := g.LocalNames["ru"]; ok && name != "" {
+		return name
+	}
+	return g.Name
 }
 
 func readConfigFile(configFilePath string) (WeatherAPIConfig, error) {
@@ -133,119 +84,344 @@ func readConfigFile(configFilePath string) (WeatherAPIConfig, error) {
 		return config, err
 	}
 
+	config.CityOrder, err = readCityOrder(configFileBytes)
+
+	if err != nil {
+		slog.Warn("Error parsing config file", "err", err)
+		return config, err
+	}
+
 	return config, nil
 }
 
-func NewWeatherAPI(apiKey string, configFile string, httpClient *http.Client, dbClient *db.Client) *WeatherAPI {
+// readCityOrder returns the keys of the "cities" object in the order they appear in the file
+func readCityOrder(data []byte) ([]string, error) {
+	order := make([]string, 0)
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+
+	// Skip to the "cities" key of the root object
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if key != "cities" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		for dec.More() {
+			name, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return nil, err
+			}
+			order = append(order, fmt.Sprint(name))
+		}
+		break
+	}
+	return order, nil
+}
+
+// NewWeatherAPI creates the weather client, provider is the name of the primary provider
+// and the other one is used as a fallback
+func NewWeatherAPI(apiKey string, provider string, configFile string, httpClient *http.Client, dbClient *db.Client) *WeatherAPI {
 	cfg, err := readConfigFile(configFile)
 
 	if err != nil {
 		slog.Warn("Error reading config file", "err", err)
 	}
 
-	return &WeatherAPI{
-		ApiKey:      apiKey,
-		Config:      cfg,
-		HttpClient:  httpClient,
-		DBClient: dbClient,
+	openWeather := &OpenWeatherProvider{ApiKey: apiKey, HttpClient: httpClient, DBClient: dbClient}
+	openMeteo := &OpenMeteoProvider{HttpClient: httpClient, DBClient: dbClient}
+	providers := []WeatherProvider{openWeather, openMeteo}
+	switch provider {
+	case openMeteo.Name():
+		providers = []WeatherProvider{openMeteo, openWeather}
+	case openWeather.Name():
+	default:
+		slog.Warn("unknown weather provider, using default", "provider", provider, "default", openWeather.Name())
+	}
+
+	weatherAPI := &WeatherAPI{
+		ApiKey:     apiKey,
+		Config:     cfg,
+		HttpClient: httpClient,
+		DBClient:   dbClient,
+		Providers:  providers,
+	}
+
+	if err := weatherAPI.seedCities(); err != nil {
+		slog.Warn("Error seeding weather cities", "err", err)
 	}
+
+	return weatherAPI
 }
 
-func (w *WeatherAPI) GetWeather() []WeatherResponse {
-	weather := make([]WeatherResponse, 0)
+// configCities returns cities from the config file in the file order
+func (w *WeatherAPI) configCities() []db.WeatherCity {
+	cities := make([]db.WeatherCity, 0, len(w.Config.Cities))
+	for _, name := range w.Config.CityOrder {
+		cp, ok := w.Config.Cities[name]
+		if !ok {
+			continue
+		}
+		cities = append(cities, db.WeatherCity{Name: name, Lat: cp.Lat, Lon: cp.Lon})
+	}
+	return cities
+}
 
-	for c, cp := range w.Config.Cities {
-		w, err := w.callCurrentAPI(cp.Lat, cp.Lon)
+// seedCities stores cities from the config file unless cities are already stored. Nothing is stored if the config
+// has no cities, e.g. it could not be read, so the config is seeded on the next start
+func (w *WeatherAPI) seedCities() error {
+	ctx := context.Background()
+	configCities := w.configCities()
+	if len(configCities) == 0 {
+		slog.Warn("no weather cities in config, skipping seeding")
+		return nil
+	}
+	cities, err := w.DBClient.GetWeatherCities(ctx)
+	if err != nil {
+		return err
+	}
+	if cities != nil {
+		return nil
+	}
+	slog.Info("seeding weather cities from config", "cities", len(configCities))
+	return w.DBClient.SetWeatherCities(ctx, configCities)
+}
+
+// Cities returns weather cities in display order
+func (w *WeatherAPI) Cities() []db.WeatherCity {
+	cities, err := w.DBClient.GetWeatherCities(context.Background())
+	if err != nil || cities == nil {
+		slog.Warn("could not get weather cities, using config", "err", err)
+		return w.configCities()
+	}
+	return cities
+}
+
+// ChatCities returns weather cities selected for the chat, all cities are returned if the chat has no selection
+func (w *WeatherAPI) ChatCities(chatID int64) []db.WeatherCity {
+	cities := w.Cities()
+	names, err := w.DBClient.GetChatWeatherCities(context.Background(), chatID)
+	if err != nil {
+		slog.Warn("could not get chat weather cities", "chat_id", chatID, "err", err)
+		return cities
+	}
+	if len(names) == 0 {
+		return cities
+	}
+
+	selected := make([]db.WeatherCity, 0, len(names))
+	for _, c := range cities {
+		if slices.Contains(names, c.Name) {
+			selected = append(selected, c)
+		}
+	}
+	return selected
+}
+
+// AddCity appends a city to the list or updates coordinates of the existing one
+func (w *WeatherAPI) AddCity(city db.WeatherCity) error {
+	cities := w.Cities()
+	for i, c := range cities {
+		if c.Name == city.Name {
+			cities[i] = city
+			return w.DBClient.SetWeatherCities(context.Background(), cities)
+		}
+	}
+	return w.DBClient.SetWeatherCities(context.Background(), append(cities, city))
+}
+
+// RemoveCity removes a city from the list
+func (w *WeatherAPI) RemoveCity(name string) error {
+	cities := w.Cities()
+	i := slices.IndexFunc(cities, func(c db.WeatherCity) bool { return c.Name == name })
+	if i < 0 {
+		return fmt.Errorf("city %s not found", name)
+	}
+	return w.DBClient.SetWeatherCities(context.Background(), slices.Delete(cities, i, i+1))
+}
+
+// MoveCity changes the display position of a city, positions start with 1
+func (w *WeatherAPI) MoveCity(name string, position int) error {
+	cities := w.Cities()
+	i := slices.IndexFunc(cities, func(c db.WeatherCity) bool { return c.Name == name })
+	if i < 0 {
+		return fmt.Errorf("city %s not found", name)
+	}
+	city := cities[i]
+	cities = slices.Delete(cities, i, i+1)
+	position = min(max(position, 1), len(cities)+1)
+	return w.DBClient.SetWeatherCities(context.Background(), slices.Insert(cities, position-1, city))
+}
+
+// GetWeather returns forecasts for all cities in display order
+func (w *WeatherAPI) GetWeather() []Forecast {
+	return w.getCitiesWeather(w.Cities())
+}
+
+// GetChatWeather returns forecasts for cities selected for the chat in display order
+func (w *WeatherAPI) GetChatWeather(chatID int64) []Forecast {
+	return w.getCitiesWeather(w.ChatCities(chatID))
+}
+
+func (w *WeatherAPI) getCitiesWeather(cities []db.WeatherCity) []Forecast {
+	weather := make([]Forecast, 0)
+
+	for _, c := range cities {
+		f, err := w.forecast(c.Lat, c.Lon)
 		if err != nil {
-			slog.Warn("could not get weather", "city", c, "err", err)
+			slog.Warn("could not get weather", "city", c.Name, "err", err)
 		} else {
-			w.City.Name = c
-			weather = append(weather, *w)
+			f.Place.Name = c.Name
+			weather = append(weather, *f)
 		}
 	}
 	return weather
 }
 
-func (w *WeatherAPI) GetMinMaxTemp(weather WeatherResponse) (float64, float64) {
-	var minTemp, maxTemp float64
-	// Parse the date of the first entry
-	firstDate, err := time.Parse("2006-01-02 15:04:05", weather.List[0].DtTxt)
+// GetWeatherByCoord returns the forecast for the given coordinates
+func (w *WeatherAPI) GetWeatherByCoord(lat, lon float64) (*Forecast, error) {
+	f, err := w.forecast(lat, lon)
 	if err != nil {
-		return minTemp, maxTemp
+		return nil, err
 	}
-	firstDay := firstDate.Day()
+	if f.Place.Name == "" {
+		f.Place.Name = fmt.Sprintf("%.2f, %.2f", lat, lon)
+	}
+	return f, nil
+}
 
-	maxTemp = weather.List[0].Main.Temp
-	minTemp = weather.List[0].Main.Temp
+// forecast asks providers in order, providers that ran out of quota are skipped for a while
+func (w *WeatherAPI) forecast(lat, lon float64) (*Forecast, error) {
+	return askProviders(w, func(p WeatherProvider) (*Forecast, error) {
+		return p.Forecast(lat, lon)
+	})
+}
 
-	// Iterate over the weather list to find the maximum temperature for the first day
-	for _, item := range weather.List {
-		itemDate, err := time.Parse("2006-01-02 15:04:05", item.DtTxt)
+// askProviders calls providers in order until one of them succeeds, providers that ran out of quota are skipped
+// for a while
+func askProviders[T any](w *WeatherAPI, call func(p WeatherProvider) (T, error)) (T, error) {
+	var zero T
+	ctx := context.Background()
+	var errs []error
+	for _, p := range w.Providers {
+		exhausted, err := w.DBClient.IsWeatherProviderExhausted(ctx, p.Name())
 		if err != nil {
+			slog.Warn("could not check weather provider quota", "provider", p.Name(), "err", err)
+		}
+		if exhausted {
 			continue
 		}
-		if itemDate.Day() == firstDay {
-			if item.Main.Temp > maxTemp {
-				maxTemp = item.Main.Temp
-			}
-			if item.Main.Temp < minTemp {
-				minTemp = item.Main.Temp
+
+		result, err := call(p)
+		if err == nil {
+			return result, nil
+		}
+		if errors.Is(err, ErrQuotaExceeded) {
+			slog.Warn("weather provider quota exceeded", "provider", p.Name())
+			if err := w.DBClient.SetWeatherProviderExhausted(ctx, p.Name(), providerExhaustedTTL); err != nil {
+				slog.Warn("could not mark weather provider exhausted", "provider", p.Name(), "err", err)
 			}
-		} else {
-			break // Stop when leaving the first day
 		}
+		errs = append(errs, fmt.Errorf("%s: %w", p.Name(), err))
 	}
-
-	return minTemp, maxTemp
+	if len(errs) == 0 {
+		return zero, fmt.Errorf("all weather providers are exhausted")
+	}
+	return zero, errors.Join(errs...)
 }
 
-func (w *WeatherAPI) callCurrentAPI(lat, lon float64) (*WeatherResponse, error) {
-	const maxRetry = 3
-	var weather WeatherResponse
+// Geocode resolves a place name into a list of candidate locations
+func (w *WeatherAPI) Geocode(query string) ([]GeoLocation, error) {
+	var locations []GeoLocation
 	ctx := context.Background()
-	baseURL := "https://api.openweathermap.org/data/2.5/forecast"
-	queryStr := fmt.Sprintf("?lat=%f&lon=%f&appid=%s&lang=ru&units=metric", lat, lon, w.ApiKey)
+	query = strings.ToLower(strings.TrimSpace(query))
 
-	v, err := w.DBClient.GetWeatherData(ctx, lat, lon)
+	v, err := w.DBClient.GetGeocodingData(ctx, query)
 	if err == nil {
-		slog.Info("hit weatherapi cache", "key", w.DBClient.WeatherKey(lat, lon))
-		err := json.Unmarshal([]byte(v), &weather)
+		slog.Info("hit geocoding cache", "key", w.DBClient.GeocodingKey(query))
+		err := json.Unmarshal([]byte(v), &locations)
 		if err == nil {
-			return &weather, nil
+			return locations, nil
 		}
 	}
 
-	for i := 1; i <= maxRetry; i++ {
-		resp, err := w.HttpClient.Get(baseURL + queryStr)
-		if err != nil {
-			return nil, err
+	locations, err = askProviders(w, func(p WeatherProvider) ([]GeoLocation, error) {
+		return p.Geocode(query)
+	})
+	if err != nil {
+		return nil, err
+	}
+	locations = uniqueLocations(locations)
+	if data, err := json.Marshal(locations); err == nil {
+		if err := w.DBClient.SetGeocodingData(ctx, query, data); err != nil {
+			slog.Info("could not write cache", "err", err)
 		}
-		defer resp.Body.Close()
+	}
+	return locations, nil
+}
 
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, err
-		}
+// ReverseGeocode finds the place at the coordinates, nil is returned if there is no named place nearby
+func (w *WeatherAPI) ReverseGeocode(lat, lon float64) (*GeoLocation, error) {
+	var locations []GeoLocation
+	ctx := context.Background()
 
-		if resp.StatusCode/100 == 2 {
-			err := w.DBClient.SetWeatherData(ctx, lat, lon, body)
-			if err != nil {
-				slog.Info("could not write cache", "err", err)
-			}
-			err = json.Unmarshal(body, &weather)
-			if err != nil {
-				return nil, err
-			}
-			return &weather, nil
+	v, err := w.DBClient.GetReverseGeocodingData(ctx, lat, lon)
+	if err == nil {
+		slog.Info("hit reverse geocoding cache", "key", w.DBClient.ReverseGeocodingKey(lat, lon))
+		err := json.Unmarshal([]byte(v), &locations)
+		if err == nil {
+			return firstLocation(locations), nil
 		}
+	}
 
-		if i < maxRetry {
-			slog.Info("got error response from api, retrying in 5 seconds...", "retry-cnt", i, "status", resp.Status, "body", string(body))
-			time.Sleep(5 * time.Second)
-		} else {
-			return nil, fmt.Errorf("got error response from api: %s - %s", resp.Status, string(body))
+	locations, err = askProviders(w, func(p WeatherProvider) ([]GeoLocation, error) {
+		return p.ReverseGeocode(lat, lon)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if data, err := json.Marshal(locations); err == nil {
+		if err := w.DBClient.SetReverseGeocodingData(ctx, lat, lon, data); err != nil {
+			slog.Info("could not write cache", "err", err)
 		}
 	}
+	return firstLocation(locations), nil
+}
+
+func firstLocation(locations []GeoLocation) *GeoLocation {
+	if len(locations) == 0 {
+		return nil
+	}
+	return &locations[0]
+}
 
-	return nil, fmt.Errorf("max retries reached")
+// uniqueLocations drops duplicate places that differ only in coordinates
+func uniqueLocations(locations []GeoLocation) []GeoLocation {
+	seen := make(map[string]bool)
+	result := make([]GeoLocation, 0, len(locations))
+	for _, l := range locations {
+		key := l.Name + "|" + l.State + "|" + l.Country
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, l)
+	}
+	return result
 }
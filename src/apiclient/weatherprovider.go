@@ -0,0 +1,84 @@
+package apiclient
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrQuotaExceeded is returned by providers when the API request limit is reached
+var ErrQuotaExceeded = errors.New("api quota exceeded")
+
+// WeatherProvider is a source of weather forecasts and geocoding
+type WeatherProvider interface {
+	Name() string
+	Forecast(lat, lon float64) (*Forecast, error)
+	// Geocode resolves a place name into a list of candidate locations
+	Geocode(query string) ([]GeoLocation, error)
+	// ReverseGeocode finds places at the coordinates, errors.ErrUnsupported is returned if the provider can't do it
+	ReverseGeocode(lat, lon float64) ([]GeoLocation, error)
+}
+
+// Forecast is a provider-neutral weather forecast for a place
+type Forecast struct {
+	Place Place
+	// TimezoneOffset is the UTC offset of the place in seconds
+	TimezoneOffset int
+	// Sunrise and Sunset of the current day
+	Sunrise time.Time
+	Sunset  time.Time
+	Current ForecastItem
+	// Items are forecast steps in chronological order
+	Items    []ForecastItem
+	Provider string
+}
+
+// Place is the location of a forecast
+type Place struct {
+	Name string
+	Lat  float64
+	Lon  float64
+}
+
+// ForecastItem holds weather conditions for a forecast step
+type ForecastItem struct {
+	Time      time.Time
+	Temp      float64
+	FeelsLike float64
+	Humidity  int
+	// WindSpeed and WindGust are in m/s
+	WindSpeed float64
+	WindGust  float64
+	// Pop is the probability of precipitation, 0..1
+	Pop float64
+	// Precipitation is the volume of rain and snow during the step, mm
+	Precipitation float64
+	Condition     Condition
+	Daytime       bool
+}
+
+// Condition describes the weather, Description is in Russian
+type Condition struct {
+	Kind        ConditionKind
+	Description string
+}
+
+// ConditionKind is a provider-neutral weather condition ordered by severity
+type ConditionKind int
+
+const (
+	ConditionClear ConditionKind = iota
+	ConditionClouds
+	ConditionFog
+	ConditionDrizzle
+	ConditionRain
+	ConditionSnow
+	ConditionHeavyRain
+	ConditionFreezingRain
+	ConditionHeavySnow
+	ConditionThunderstorm
+)
+
+// Location returns the fixed time zone of the place
+func (f Forecast) Location() *time.Location {
+	return time.FixedZone(f.Place.Name, f.TimezoneOffset)
+}
@@ -0,0 +1,161 @@
+package apiclient
+
+import (
+	"math"
+	"time"
+)
+
+// WeatherSummary is a forecast aggregated into days of the city's local time zone
+type WeatherSummary struct {
+	City     string
+	Location *time.Location
+	Current  ForecastItem
+	Sunrise  time.Time
+	Sunset   time.Time
+	Days     []DaySummary
+}
+
+// DaySummary aggregates forecast items of a single local day
+type DaySummary struct {
+	// Date is the local midnight of the day
+	Date    time.Time
+	MinTemp float64
+	MaxTemp float64
+	// Condition is the most frequent daytime condition
+	Condition Condition
+	// Precipitation is the total volume of rain and snow, mm
+	Precipitation float64
+	// Pop is the highest probability of precipitation, 0..1
+	Pop      float64
+	MaxGust  float64
+	Sunrise  time.Time
+	Sunset   time.Time
+	Daylight time.Duration
+	Items    []ForecastItem
+}
+
+// Day returns the summary of the local day at the given offset from today, nil if it is not in the forecast
+func (s WeatherSummary) Day(offset int) *DaySummary {
+	now := time.Now().In(s.Location)
+	date := time.Date(now.Year(), now.Month(), now.Day()+offset, 0, 0, 0, 0, s.Location)
+	for i := range s.Days {
+		if s.Days[i].Date.Equal(date) {
+			return &s.Days[i]
+		}
+	}
+	return nil
+}
+
+// Today returns the summary of the current local day or the first forecast day
+func (s WeatherSummary) Today() DaySummary {
+	if d := s.Day(0); d != nil {
+		return *d
+	}
+	if len(s.Days) > 0 {
+		return s.Days[0]
+	}
+	return DaySummary{}
+}
+
+// NewWeatherSummary groups forecast items into local days using the place's time zone
+func NewWeatherSummary(f Forecast) WeatherSummary {
+	location := f.Location()
+	summary := WeatherSummary{
+		City:     f.Place.Name,
+		Location: location,
+		Current:  f.Current,
+		Sunrise:  f.Sunrise.In(location),
+		Sunset:   f.Sunset.In(location),
+		Days:     make([]DaySummary, 0),
+	}
+
+	for _, item := range f.Items {
+		t := item.Time.In(location)
+		date := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, location)
+
+		if len(summary.Days) == 0 || !summary.Days[len(summary.Days)-1].Date.Equal(date) {
+			summary.Days = append(summary.Days, DaySummary{Date: date, MinTemp: item.Temp, MaxTemp: item.Temp})
+		}
+
+		d := &summary.Days[len(summary.Days)-1]
+		d.MinTemp = min(d.MinTemp, item.Temp)
+		d.MaxTemp = max(d.MaxTemp, item.Temp)
+		d.Precipitation += item.Precipitation
+		d.Pop = max(d.Pop, item.Pop)
+		d.MaxGust = max(d.MaxGust, item.WindGust)
+		d.Items = append(d.Items, item)
+	}
+
+	for i := range summary.Days {
+		d := &summary.Days[i]
+		d.Condition = dominantCondition(d.Items)
+		d.Sunrise, d.Sunset = sunTimes(d.Date, f.Place.Lat, f.Place.Lon)
+		if d.Date.Equal(time.Date(summary.Sunrise.Year(), summary.Sunrise.Month(), summary.Sunrise.Day(), 0, 0, 0, 0, location)) {
+			// The API knows exact times for the current day
+			d.Sunrise, d.Sunset = summary.Sunrise, summary.Sunset
+		}
+		d.Daylight = d.Sunset.Sub(d.Sunrise)
+	}
+
+	return summary
+}
+
+// dominantCondition returns the most frequent condition of the day, night items are used only if there is no daytime one
+func dominantCondition(items []ForecastItem) Condition {
+	counts := make(map[Condition]int)
+	for _, daytimeOnly := range []bool{true, false} {
+		for _, item := range items {
+			if item.Condition.Description == "" || (daytimeOnly && !item.Daytime) {
+				continue
+			}
+			counts[item.Condition]++
+		}
+		if len(counts) > 0 {
+			break
+		}
+	}
+
+	var dominant Condition
+	best := 0
+	for c, cnt := range counts {
+		// On a tie the more severe condition wins
+		if cnt > best || (cnt == best && (c.Kind > dominant.Kind || (c.Kind == dominant.Kind && c.Description < dominant.Description))) {
+			best = cnt
+			dominant = c
+		}
+	}
+	return dominant
+}
+
+// sunTimes calculates sunrise and sunset for the day with the sunrise equation,
+// during polar night both are noon and during polar day they span the whole day
+func sunTimes(date time.Time, lat, lon float64) (time.Time, time.Time) {
+	const (
+		j2000      = 2451545.0
+		unixEpochJ = 2440587.5
+	)
+	rad := math.Pi / 180
+	fromJulian := func(j float64) time.Time {
+		return time.Unix(int64((j-unixEpochJ)*86400), 0).In(date.Location())
+	}
+
+	noon := date.Add(12 * time.Hour)
+	julian := float64(noon.Unix())/86400 + unixEpochJ
+	n := math.Ceil(julian - j2000 - 0.0009)
+	meanSolarTime := n - lon/360
+	anomaly := math.Mod(357.5291+0.98560028*meanSolarTime, 360)
+	center := 1.9148*math.Sin(anomaly*rad) + 0.02*math.Sin(2*anomaly*rad) + 0.0003*math.Sin(3*anomaly*rad)
+	longitude := math.Mod(anomaly+center+180+102.9372, 360)
+	transit := j2000 + meanSolarTime + 0.0053*math.Sin(anomaly*rad) - 0.0069*math.Sin(2*longitude*rad)
+	declination := math.Asin(math.Sin(longitude*rad) * math.Sin(23.4397*rad))
+
+	cosHourAngle := (math.Sin(-0.833*rad) - math.Sin(lat*rad)*math.Sin(declination)) / (math.Cos(lat*rad) * math.Cos(declination))
+	switch {
+	case cosHourAngle > 1:
+		return fromJulian(transit), fromJulian(transit)
+	case cosHourAngle < -1:
+		return date, date.AddDate(0, 0, 1)
+	}
+	hourAngle := math.Acos(cosHourAngle) / rad
+	return fromJulian(transit - hourAngle/360), fromJulian(transit + hourAngle/360)
+}
@@ -0,0 +1,223 @@
+package bot
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/rahfar/familybot/src/apiclient"
+	"github.com/rahfar/familybot/src/db"
+	"github.com/rahfar/familybot/src/metrics"
+)
+
+const autoTranslateUsage = "Использование:\n" +
+	"/autotranslate - настройки автоперевода\n" +
+	"/autotranslate on|off - включить или выключить\n" +
+	"/autotranslate langs ru,en - языки чата, сообщения на других языках переводятся на первый\n" +
+	"/autotranslate minlen <символов> - не переводить короткие сообщения\n" +
+	"/autotranslate budget <символов> - лимит символов DeepL в день\n" +
+	"/autotranslate exclude|include <id> или ответом на сообщение - не переводить сообщения участника"
+
+var langCodeRe = regexp.MustCompile(`^[a-z]{2,3}$`)
+
+// autoTranslate replies with a translation to a message in a language that is not one of the chat's languages
+func (b *Bot) autoTranslate(msg *tgbotapi.Message) {
+	ctx := context.Background()
+	chatID := msg.Chat.ID
+	settings, err := b.DBClient.GetAutoTranslateSettings(ctx, chatID)
+	if err != nil {
+		slog.Error("error getting auto-translate settings", "err", err, "chat_id", chatID)
+		return
+	}
+	if !settings.Enabled || len(settings.Languages) == 0 || msg.From == nil || msg.From.IsBot {
+		return
+	}
+	if slices.Contains(settings.ExcludedUsers, msg.From.ID) {
+		return
+	}
+	if strings.HasPrefix(cmp.Or(msg.Text, msg.Caption), "/") {
+		return
+	}
+	// Links, mentions and code are not translated and would be taken for English text
+	text := strings.TrimSpace(stripEntities(msg.Text, msg.Entities))
+	if msg.Text == "" {
+		text = strings.TrimSpace(stripEntities(msg.Caption, msg.CaptionEntities))
+	}
+	chars := utf8.RuneCountInString(text)
+	if chars < settings.MinLength {
+		return
+	}
+	// The local guess only skips messages that are clearly in a chat language, DeepL detects the language itself
+	lang := apiclient.DetectLanguage(text)
+	if lang == "" || slices.Contains(settings.Languages, lang) {
+		return
+	}
+
+	used, err := b.DBClient.GetAutoTranslateChars(ctx, chatID)
+	if err != nil {
+		slog.Error("error getting auto-translate usage", "err", err, "chat_id", chatID)
+		return
+	}
+	if used+chars > settings.DailyBudget {
+		slog.Info("auto-translate budget is spent", "chat_id", chatID, "used", used, "budget", settings.DailyBudget)
+		metrics.AutoTranslateCounter.With(prometheus.Labels{"result": "budget"}).Inc()
+		return
+	}
+
+	result, err := b.Translator.Translate(ctx, text, "", settings.Languages[0])
+	// Only DeepL has a free quota to save, LLM and cached translations are not counted
+	if result.Provider == "deepl" && !result.Cached {
+		if err := b.DBClient.AddAutoTranslateChars(ctx, chatID, chars); err != nil {
+			slog.Error("error saving auto-translate usage", "err", err, "chat_id", chatID)
+		}
+	}
+	if errors.Is(err, apiclient.ErrSameLanguage) || (err == nil && slices.Contains(settings.Languages, result.SourceLang)) {
+		slog.Info("message is in a chat language", "chat_id", chatID, "guess", lang, "lang", result.SourceLang)
+		return
+	}
+	if err != nil {
+		slog.Error("error auto-translating message", "err", err, "chat_id", chatID, "lang", lang)
+		metrics.AutoTranslateCounter.With(prometheus.Labels{"result": "error"}).Inc()
+		return
+	}
+	metrics.AutoTranslateCounter.With(prometheus.Labels{"result": "translated"}).Inc()
+
+	msgConfig := tgbotapi.NewMessage(chatID, formatLangPair(result.SourceLang, settings.Languages[0])+" "+result.Text)
+	msgConfig.ReplyToMessageID = msg.MessageID
+	msgConfig.DisableNotification = true
+	msgConfig.DisableWebPagePreview = true
+	b.sendMessage(msgConfig)
+}
+
+// strippedEntities are entities that are left out of auto-translation
+var strippedEntities = []string{"url", "text_link", "mention", "code", "pre"}
+
+// stripEntities replaces links, mentions and code in the text with spaces, entity offsets are in UTF-16 code units
+func stripEntities(text string, entities []tgbotapi.MessageEntity) string {
+	units := utf16.Encode([]rune(text))
+	for _, e := range entities {
+		if !slices.Contains(strippedEntities, e.Type) || e.Offset < 0 || e.Offset+e.Length > len(units) {
+			continue
+		}
+		for i := e.Offset; i < e.Offset+e.Length; i++ {
+			units[i] = ' '
+		}
+	}
+	return string(utf16.Decode(units))
+}
+
+// manageAutoTranslate shows and changes auto-translation settings of the chat
+func manageAutoTranslate(b *Bot, msg *tgbotapi.Message) {
+	ctx := context.Background()
+	chatID := msg.Chat.ID
+	settings, err := b.DBClient.GetAutoTranslateSettings(ctx, chatID)
+	if err != nil {
+		slog.Error("error getting auto-translate settings", "err", err, "chat_id", chatID)
+		b.replyTo(msg, "Ошибка при получении настроек")
+		return
+	}
+
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) == 0 {
+		used, err := b.DBClient.GetAutoTranslateChars(ctx, chatID)
+		if err != nil {
+			slog.Error("error getting auto-translate usage", "err", err, "chat_id", chatID)
+		}
+		b.replyTo(msg, formatAutoTranslateSettings(settings, used))
+		return
+	}
+
+	switch {
+	case len(args) == 1 && (args[0] == "on" || args[0] == "off"):
+		settings.Enabled = args[0] == "on"
+	case len(args) == 2 && args[0] == "langs":
+		langs := strings.Split(strings.ToLower(args[1]), ",")
+		for _, lang := range langs {
+			if !langCodeRe.MatchString(lang) {
+				b.replyTo(msg, fmt.Sprintf("Неверный язык %s, пример: langs ru,en", lang))
+				return
+			}
+		}
+		settings.Languages = langs
+	case len(args) == 2 && (args[0] == "minlen" || args[0] == "budget"):
+		value, parseErr := strconv.Atoi(args[1])
+		if parseErr != nil || value < 0 {
+			b.replyTo(msg, "Неверное значение")
+			return
+		}
+		if args[0] == "minlen" {
+			settings.MinLength = value
+		} else {
+			settings.DailyBudget = value
+		}
+	case args[0] == "exclude" || args[0] == "include":
+		var userID int64
+		switch {
+		case len(args) == 2:
+			userID, err = strconv.ParseInt(args[1], 10, 64)
+			if err != nil {
+				b.replyTo(msg, "Неверный ID пользователя")
+				return
+			}
+		case len(args) == 1 && msg.ReplyToMessage != nil && msg.ReplyToMessage.From != nil:
+			userID = msg.ReplyToMessage.From.ID
+		default:
+			b.replyTo(msg, autoTranslateUsage)
+			return
+		}
+		settings.ExcludedUsers = slices.DeleteFunc(settings.ExcludedUsers, func(id int64) bool { return id == userID })
+		if args[0] == "exclude" {
+			settings.ExcludedUsers = append(settings.ExcludedUsers, userID)
+		}
+	default:
+		b.replyTo(msg, autoTranslateUsage)
+		return
+	}
+
+	if err := b.DBClient.SetAutoTranslateSettings(ctx, chatID, settings); err != nil {
+		slog.Error("error saving auto-translate settings", "err", err, "chat_id", chatID)
+		b.replyTo(msg, "Ошибка при сохранении настроек")
+		return
+	}
+	b.replyTo(msg, "Настройки сохранены")
+}
+
+func formatAutoTranslateSettings(s db.AutoTranslateSettings, used int) string {
+	status := "выключен"
+	if s.Enabled {
+		status = "включен"
+	}
+	excluded := "нет"
+	if len(s.ExcludedUsers) > 0 {
+		ids := make([]string, 0, len(s.ExcludedUsers))
+		for _, id := range s.ExcludedUsers {
+			ids = append(ids, strconv.FormatInt(id, 10))
+		}
+		excluded = strings.Join(ids, ", ")
+	}
+	return fmt.Sprintf(
+		"Автоперевод %s\n"+
+			"Языки чата (langs): %s\n"+
+			"Минимальная длина (minlen): %d символов\n"+
+			"Лимит DeepL (budget): %d из %d символов за сегодня\n"+
+			"Без перевода (exclude): %s\n\n%s",
+		status,
+		strings.Join(s.Languages, ", "),
+		s.MinLength,
+		used,
+		s.DailyBudget,
+		excluded,
+		autoTranslateUsage,
+	)
+}
@@ -6,7 +6,6 @@ import (
 	"log/slog"
 	"net/http"
 	"slices"
-	"sort"
 	"strings"
 	"time"
 
@@ -30,14 +29,21 @@ type Bot struct {
 	ExchangeAPI  *apiclient.ExchangeAPI
 	OpenaiAPI    *apiclient.OpenaiAPI
 	WeatherAPI   *apiclient.WeatherAPI
-	MinifluxAPI  *apiclient.MinifluxAPI
+	NewsAPI      apiclient.NewsProvider
 	DeeplAPI     *apiclient.DeeplAPI
+	Summarizer   *apiclient.Summarizer
+	Translator   *apiclient.Translator
 	DBClient     *db.Client
 }
 
 func (b *Bot) Run() {
 	go b.startWebAPI()
 	go b.mourningJob()
+	go b.eveningJob()
+	go b.weeklyJob()
+	go b.weatherAlertJob()
+	go b.currencyAlertJob()
+	go b.newsPushJob()
 
 	_, err := b.initCommands()
 	if err != nil {
@@ -49,6 +55,18 @@ func (b *Bot) Run() {
 	update_cfg.Timeout = 60
 	updates := b.TGBotAPI.GetUpdatesChan(update_cfg)
 	for update := range updates {
+		if update.CallbackQuery != nil && update.CallbackQuery.Message != nil {
+			// Check authorization of the chat the keyboard was sent to on behalf of the user pressing the button
+			msg := *update.CallbackQuery.Message
+			msg.From = update.CallbackQuery.From
+			if !b.isChatAuthorized(msg) {
+				slog.Info("skip callback from unsupported chat", "chat", *msg.Chat)
+				continue
+			}
+			go b.onCallbackQuery(*update.CallbackQuery)
+			continue
+		}
+
 		if update.Message == nil || update.Message.Chat == nil {
 			continue
 		}
@@ -88,10 +106,14 @@ func (b *Bot) Run() {
 }
 
 func findCommand(msgText string) *Command {
-	for _, cmd := range Commands {
-		if strings.HasPrefix(msgText, cmd.Name) {
-			return &cmd
-		}
+	// Match the first word exactly so commands sharing a prefix (/weather, /weatheralerts) don't collide
+	fields := strings.Fields(msgText)
+	if len(fields) == 0 {
+		return nil
+	}
+	name, _, _ := strings.Cut(fields[0], "@")
+	if cmd, exists := Commands[name]; exists {
+		return &cmd
 	}
 	return nil
 }
@@ -107,6 +129,10 @@ func (b *Bot) onMessage(msg tgbotapi.Message) {
 		cmd.Handler(b, &msg)
 	} else if msg.Voice != nil {
 		transcriptVoice(b, &msg)
+	} else if msg.Location != nil {
+		onLocation(b, &msg)
+	} else if msg.Chat.IsPrivate() && b.tryConvertText(&msg) {
+		return
 	} else if msg.Chat.IsPrivate() {
 		cmd, exists := Commands["/gpt"]
 		if !exists {
@@ -114,118 +140,14 @@ func (b *Bot) onMessage(msg tgbotapi.Message) {
 			return
 		}
 		cmd.Handler(b, &msg)
+	} else if msg.Text != "" || msg.Caption != "" {
+		b.autoTranslate(&msg)
 	} else {
 		slog.Info("unsupported command")
 		return
 	}
 }
 
-func (b *Bot) mourningDigest() string {
-	text := "Доброе утро\\! 🌅\n"
-
-	// call currency api
-	xr_today, err1 := b.ExchangeAPI.GetExchangeRates(time.Now().UTC())
-	xr_yesterday, err2 := b.ExchangeAPI.GetExchangeRates(time.Now().UTC().Add(-48 * time.Hour))
-	switch {
-	case err1 != nil:
-		slog.Error("could not get currency exchange rates", "err", err1)
-	case err2 != nil:
-		slog.Error("could not get currency history exchange rates", "err", err2)
-	default:
-		USDRUB_today := xr_today.Data.RUB.Value
-		EURRUB_today := xr_today.Data.RUB.Value / xr_today.Data.EUR.Value
-		BTCUSD_today := 1.0 / xr_today.Data.BTC.Value
-		USDRUB_yesterday := xr_yesterday.Data.RUB.Value
-		EURRUB_yesterday := xr_yesterday.Data.RUB.Value / xr_yesterday.Data.EUR.Value
-		BTCUSD_yesterday := 1.0 / xr_yesterday.Data.BTC.Value
-
-		text += "\n_Курсы валют:_\n" + tgbotapi.EscapeText(
-			tgbotapi.ModeMarkdownV2,
-			fmt.Sprintf(
-				"USD %.2f₽ (%+.2f%%) \nEUR %.2f₽ (%+.2f%%)\nBTC %.2f$ (%+.2f%%)\n",
-				USDRUB_today,
-				(USDRUB_today/USDRUB_yesterday-1)*100,
-				EURRUB_today,
-				(EURRUB_today/EURRUB_yesterday-1)*100,
-				BTCUSD_today,
-				(BTCUSD_today/BTCUSD_yesterday-1)*100,
-			),
-		)
-	}
-
-	// call weather api
-	weather := b.WeatherAPI.GetWeather()
-	sort.Slice(weather, func(i, j int) bool {
-		return weather[i].List[0].Main.Temp < weather[j].List[0].Main.Temp
-	})
-	if len(weather) > 0 {
-		text += "\n_Прогноз погоды:_\n"
-		for _, w := range weather {
-			location := time.FixedZone("custom", w.City.Timezone)
-			sunriseTime := time.Unix(w.City.Sunrise, 0).In(location).Format("15:04")
-			sunsetTime := time.Unix(w.City.Sunset, 0).In(location).Format("15:04")
-			minTemp, maxTemp := b.WeatherAPI.GetMinMaxTemp(w)
-			text += fmt.Sprintf("*%s:*\n", w.City.Name)
-			text += tgbotapi.EscapeText(
-				tgbotapi.ModeMarkdownV2,
-				fmt.Sprintf(
-					"  %d°C (min: %d°C, max: %d°C), %s\n  восход: %s закат: %s\n",
-					int(w.List[0].Main.Temp),
-					int(minTemp),
-					int(maxTemp),
-					w.List[0].Weather[0].Description,
-					sunriseTime,
-					sunsetTime,
-				),
-			)
-		}
-	}
-
-	nt_news, nt_err := b.MinifluxAPI.GetLatestNews("https://www.nytimes.com", 3)
-	tass_news, tass_err := b.MinifluxAPI.GetLatestNews("https://tass.ru", 2)
-	if (nt_err != nil) || (len(nt_news) == 0) || (tass_err != nil) || (len(tass_news) == 0) {
-		slog.Error("error calling news api", "err", nt_err, "tass_err", tass_err)
-	} else {
-		fmt_news := "\n_Последние новости:_\nNew York Times\n"
-		i := 1
-		for _, n := range nt_news {
-			translatedTitle, err := b.DeeplAPI.CallDeeplAPI([]string{n.Title})
-			if err != nil {
-				slog.Error("error calling deepl api", "err", err)
-				translatedTitle = n.Title
-			}
-			translatedTitle = tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, translatedTitle)
-			escaped_url := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, n.URL)
-			fmt_news += fmt.Sprintf("%d\\. [%s](%s)\n", i, translatedTitle, escaped_url)
-			i++
-		}
-		fmt_news += "ТАСС\n"
-		for _, n := range tass_news {
-			title := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, n.Title)
-			escaped_url := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, n.URL)
-			fmt_news += fmt.Sprintf("%d\\. [%s](%s)\n", i, title, escaped_url)
-			i++
-		}
-		text += fmt_news
-	}
-	return text
-}
-
-func (b *Bot) mourningJob() {
-	metrics.MourningJobCounter.Inc()
-	slog.Info("starting mourning job")
-	for {
-		waitUntilMourning()
-		text := b.mourningDigest()
-		// send message to group
-		msg := tgbotapi.NewMessage(b.GroupID, text)
-		msg.ParseMode = tgbotapi.ModeMarkdownV2
-		msg.DisableWebPagePreview = true
-
-		b.sendMessage(msg)
-	}
-}
-
 func (b *Bot) isChatAuthorized(msg tgbotapi.Message) bool {
 	chatID := msg.Chat.ID
 
@@ -320,6 +242,13 @@ func (b *Bot) storeChatInfo(msg tgbotapi.Message) {
 	}
 }
 
+// replyTo sends a plain text reply to the message
+func (b *Bot) replyTo(msg *tgbotapi.Message, text string) {
+	msgConfig := tgbotapi.NewMessage(msg.Chat.ID, text)
+	msgConfig.ReplyToMessageID = msg.MessageID
+	b.sendMessage(msgConfig)
+}
+
 func (b *Bot) sendMessage(msg tgbotapi.MessageConfig) {
 	const (
 		maxRetry     = 3
@@ -366,14 +295,23 @@ func (b *Bot) sendMessage(msg tgbotapi.MessageConfig) {
 	}
 }
 
-func waitUntilMourning() {
-	t := time.Now()
-	desiredTime := time.Date(t.Year(), t.Month(), t.Day(), 7, 0, 0, 0, t.Location())
-	if desiredTime.Sub(t) <= 5*time.Second {
-		desiredTime = desiredTime.Add(24 * time.Hour)
+func (b *Bot) sendPhoto(photo tgbotapi.PhotoConfig) {
+	const maxRetry = 3
+
+	for i := 1; i <= maxRetry; i++ {
+		_, err := b.TGBotAPI.Send(photo)
+		if err == nil {
+			metrics.SentMsgCounter.Inc()
+			return
+		}
+
+		if i < maxRetry {
+			slog.Info("error sending photo, retrying in 5 seconds...", "err", err, "retry-cnt", i)
+			time.Sleep(5 * time.Second)
+		} else {
+			slog.Error("error sending photo", "err", err)
+		}
 	}
-	slog.Info("waiting until mourning", "time-to-wait", desiredTime.Sub(t).String())
-	time.Sleep(desiredTime.Sub(t))
 }
 
 func pingHandler(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,43 @@
+package bot
+
+import (
+	"log/slog"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/rahfar/familybot/src/metrics"
+)
+
+// Callbacks maps the prefix of inline keyboard callback data to its handler,
+// the handler receives the data without the prefix
+var Callbacks = map[string]func(*Bot, *tgbotapi.CallbackQuery, string){
+	"weather":  onWeatherCallback,
+	"forecast": onForecastCallback,
+	"news":     onNewsCallback,
+}
+
+func (b *Bot) onCallbackQuery(query tgbotapi.CallbackQuery) {
+	slog.Debug("received callback query", "query", query)
+
+	// Remove the loading indicator on the button
+	if _, err := b.TGBotAPI.Request(tgbotapi.NewCallback(query.ID, "")); err != nil {
+		slog.Info("could not answer callback query", "err", err)
+	}
+
+	prefix, data, _ := strings.Cut(query.Data, ":")
+	handler, exists := Callbacks[prefix]
+	if !exists {
+		slog.Info("unsupported callback", "data", query.Data)
+		return
+	}
+	metrics.CallbackCallsCounter.With(prometheus.Labels{"callback": prefix}).Inc()
+	handler(b, &query, data)
+}
+
+func (b *Bot) deleteMessage(chatID int64, messageID int) {
+	if _, err := b.TGBotAPI.Request(tgbotapi.NewDeleteMessage(chatID, messageID)); err != nil {
+		slog.Info("could not delete message", "err", err, "chat_id", chatID, "message_id", messageID)
+	}
+}
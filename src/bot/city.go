@@ -0,0 +1,148 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/rahfar/familybot/src/db"
+)
+
+const cityUsage = "Использование:\n" +
+	"/city list - список городов\n" +
+	"/city add <название> <lat> <lon> - добавить город по координатам\n" +
+	"/city add <название> = <запрос> - добавить город через поиск\n" +
+	"/city add <запрос> - добавить найденный город\n" +
+	"/city remove <название> - удалить город\n" +
+	"/city move <название> <позиция> - изменить порядок\n" +
+	"/city chat <название>, <название> - города для этого чата, /city chat all - все"
+
+// manageCities handles /city commands to manage weather cities at runtime
+func manageCities(b *Bot, msg *tgbotapi.Message) {
+	subcommand, args, _ := strings.Cut(strings.TrimSpace(msg.CommandArguments()), " ")
+	args = strings.TrimSpace(args)
+
+	if subcommand == "" || subcommand == "list" {
+		b.replyTo(msg, b.formatCities(msg.Chat.ID))
+		return
+	}
+
+	if !b.isUserAdmin(msg.From.ID) {
+		b.replyTo(msg, "У вас нет прав для выполнения этой команды")
+		return
+	}
+
+	var err error
+	switch subcommand {
+	case "add":
+		var city *db.WeatherCity
+		city, err = b.parseCity(args)
+		if err != nil {
+			b.replyTo(msg, err.Error())
+			return
+		}
+		err = b.WeatherAPI.AddCity(*city)
+		if err == nil {
+			b.replyTo(msg, fmt.Sprintf("Город %s добавлен (%.4f, %.4f)", city.Name, city.Lat, city.Lon))
+			return
+		}
+	case "remove":
+		err = b.WeatherAPI.RemoveCity(args)
+	case "move":
+		fields := strings.Fields(args)
+		if len(fields) < 2 {
+			b.replyTo(msg, cityUsage)
+			return
+		}
+		position, parseErr := strconv.Atoi(fields[len(fields)-1])
+		if parseErr != nil {
+			b.replyTo(msg, "Неверная позиция")
+			return
+		}
+		err = b.WeatherAPI.MoveCity(strings.Join(fields[:len(fields)-1], " "), position)
+	case "chat":
+		names := make([]string, 0)
+		if args != "all" {
+			for _, name := range strings.Split(args, ",") {
+				name = strings.TrimSpace(name)
+				if !slices.ContainsFunc(b.WeatherAPI.Cities(), func(c db.WeatherCity) bool { return c.Name == name }) {
+					b.replyTo(msg, fmt.Sprintf("Город %s не найден", name))
+					return
+				}
+				names = append(names, name)
+			}
+		}
+		err = b.DBClient.SetChatWeatherCities(context.Background(), msg.Chat.ID, names)
+	default:
+		b.replyTo(msg, cityUsage)
+		return
+	}
+
+	if err != nil {
+		slog.Error("error managing weather cities", "err", err, "subcommand", subcommand, "args", args)
+		b.replyTo(msg, "Ошибка: "+err.Error())
+		return
+	}
+	b.replyTo(msg, b.formatCities(msg.Chat.ID))
+}
+
+// parseCity parses "<name> <lat> <lon>", "<name> = <query>" or "<query>"
+func (b *Bot) parseCity(args string) (*db.WeatherCity, error) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("%s", cityUsage)
+	}
+
+	if len(fields) >= 3 {
+		lat, err1 := strconv.ParseFloat(fields[len(fields)-2], 64)
+		lon, err2 := strconv.ParseFloat(fields[len(fields)-1], 64)
+		if err1 == nil && err2 == nil {
+			if lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+				return nil, fmt.Errorf("неверные координаты, широта от -90 до 90, долгота от -180 до 180")
+			}
+			return &db.WeatherCity{Name: strings.Join(fields[:len(fields)-2], " "), Lat: lat, Lon: lon}, nil
+		}
+	}
+
+	name, query, found := strings.Cut(args, "=")
+	if !found {
+		query = args
+	}
+	name, query = strings.TrimSpace(name), strings.TrimSpace(query)
+
+	locations, err := b.WeatherAPI.Geocode(query)
+	if err != nil {
+		slog.Error("error calling geocoding api", "err", err, "query", query)
+		return nil, fmt.Errorf("ошибка при поиске города")
+	}
+	if len(locations) == 0 {
+		return nil, fmt.Errorf("город не найден")
+	}
+	if !found {
+		name = locations[0].LocalName()
+	}
+	return &db.WeatherCity{Name: name, Lat: locations[0].Lat, Lon: locations[0].Lon}, nil
+}
+
+func (b *Bot) formatCities(chatID int64) string {
+	cities := b.WeatherAPI.Cities()
+	if len(cities) == 0 {
+		return "Список городов пуст"
+	}
+	chatCities := b.WeatherAPI.ChatCities(chatID)
+
+	text := "Города (✓ - показываются в этом чате):\n"
+	for i, c := range cities {
+		mark := " "
+		if slices.Contains(chatCities, c) {
+			mark = "✓"
+		}
+		text += fmt.Sprintf("%d. %s %s (%.4f, %.4f)\n", i+1, mark, c.Name, c.Lat, c.Lon)
+	}
+	return text
+}
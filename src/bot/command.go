@@ -30,6 +30,18 @@ var Commands = map[string]Command{
 		Handler:     sendMourningDigest,
 		Hidden:      true,
 	},
+	"/evening": {
+		Name:        "/evening",
+		Description: "Debug evening job",
+		Handler:     sendEveningDigest,
+		Hidden:      true,
+	},
+	"/weekly": {
+		Name:        "/weekly",
+		Description: "Debug weekly job",
+		Handler:     sendWeeklyDigest,
+		Hidden:      true,
+	},
 	"/revision": {
 		Name:        "/revision",
 		Description: "Версия бота.",
@@ -38,10 +50,84 @@ var Commands = map[string]Command{
 	},
 	"/weather": {
 		Name:        "/weather",
-		Description: "Прогноз погоды в заданных городах.",
+		Description: "Прогноз погоды в заданных городах или в указанном: /weather <город>.",
 		Handler:     getCurrentWeather,
 		Hidden:      true,
 	},
+	"/forecast": {
+		Name:        "/forecast",
+		Description: "График прогноза погоды: /forecast [город] [дней].",
+		Handler:     getForecast,
+	},
+	"/weatheralerts": {
+		Name:        "/weatheralerts",
+		Description: "Настройка предупреждений о непогоде в чате.",
+		Handler:     manageWeatherAlerts,
+		Hidden:      true,
+	},
+	"/city": {
+		Name:        "/city",
+		Description: "Управление городами прогноза погоды (только для админов).",
+		Handler:     manageCities,
+		Hidden:      true,
+	},
+	"/here": {
+		Name:        "/here",
+		Description: "Сохранить свою геопозицию для /weather, /here off - удалить.",
+		Handler:     setPersonalLocation,
+		Hidden:      true,
+	},
+	"/rates": {
+		Name:        "/rates",
+		Description: "Курсы валют: /rates add|remove <пара>, /rates reset.",
+		Handler:     manageRates,
+	},
+	"/convert": {
+		Name:        "/convert",
+		Description: "Пересчет валют и единиц: /convert <количество> <из> [в].",
+		Handler:     convert,
+	},
+	"/alert": {
+		Name:        "/alert",
+		Description: "Оповещения о курсах валют: /alert add|list|remove.",
+		Handler:     manageCurrencyAlerts,
+	},
+	"/chart": {
+		Name:        "/chart",
+		Description: "График курса валютной пары: /chart USD/RUB 90d.",
+		Handler:     getRateChart,
+	},
+	"/backfill": {
+		Name:        "/backfill",
+		Description: "Загрузить историю курсов валют: /backfill [дней] (только для админов).",
+		Handler:     backfillRates,
+		Hidden:      true,
+	},
+	"/news": {
+		Name:        "/news",
+		Description: "Непрочитанные новости: /news [feed:<id>|category:<id>].",
+		Handler:     getNews,
+	},
+	"/subscribe": {
+		Name:        "/subscribe",
+		Description: "Присылать новые записи ленты: /subscribe <источник> [lang:RU] [слова].",
+		Handler:     subscribeNews,
+	},
+	"/unsubscribe": {
+		Name:        "/unsubscribe",
+		Description: "Отменить подписку на ленту: /unsubscribe <номер>.",
+		Handler:     unsubscribeNews,
+	},
+	"/summarize": {
+		Name:        "/summarize",
+		Description: "Краткий пересказ статьи: /summarize <ссылка> или ответом на сообщение со ссылкой.",
+		Handler:     summarize,
+	},
+	"/newssources": {
+		Name:        "/newssources",
+		Description: "Источники новостей дайджеста: /newssources add|remove|reset.",
+		Handler:     manageNewsSources,
+	},
 	"/restart": {
 		Name:        "/restart",
 		Description: "Сбросить контекст в работе с ChatGPT.",
@@ -59,15 +145,25 @@ var Commands = map[string]Command{
 		Handler:     correctEnglish,
 		Hidden:      true,
 	},
+	"/tr": {
+		Name:        "/tr",
+		Description: "Перевод на любой язык: /tr [исходный>]язык <текст> или ответом на сообщение, например /tr fi или /tr de>ru.",
+		Handler:     translate,
+	},
+	"/autotranslate": {
+		Name:        "/autotranslate",
+		Description: "Автоперевод сообщений на других языках: /autotranslate on|off|langs|minlen|budget|exclude.",
+		Handler:     manageAutoTranslate,
+	},
 	"/en2ru": {
 		Name:        "/en2ru",
-		Description: "Перевод с английского на русский.",
+		Description: "Перевод с английского на русский, то же что /tr en>ru.",
 		Handler:     translateEng2Ru,
 		Hidden:      true,
 	},
 	"/ru2en": {
 		Name:        "/ru2en",
-		Description: "Перевод с русского на английский.",
+		Description: "Перевод с русского на английский, то же что /tr ru>en.",
 		Handler:     translateRu2Eng,
 		Hidden:      true,
 	},
@@ -89,6 +185,18 @@ var Commands = map[string]Command{
 		Handler:     listUsers,
 		Hidden:      true,
 	},
+	"/feeds": {
+		Name:        "/feeds",
+		Description: "Ленты новостей для /newssources: /feeds [refresh] (только для админов).",
+		Handler:     listFeeds,
+		Hidden:      true,
+	},
+	"/glossary": {
+		Name:        "/glossary",
+		Description: "Глоссарии DeepL для имен и терминов: /glossary en>ru add <термин> = <перевод> (только для админов).",
+		Handler:     manageGlossary,
+		Hidden:      true,
+	},
 	"/invite": {
 		Name:        "/invite",
 		Description: "Сгенерировать ссылку приглашения (только для админов).",
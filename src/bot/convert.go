@@ -0,0 +1,130 @@
+package bot
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/rahfar/familybot/src/apiclient"
+	"github.com/rahfar/familybot/src/metrics"
+	"github.com/rahfar/familybot/src/units"
+)
+
+const convertUsage = "Использование: /convert <количество> <из> [в], например /convert 350 EUR RUB или /convert 72 F C"
+
+var (
+	// convertArgsRe matches "<amount> <from> [[в|to|in] <to>]"
+	convertArgsRe = regexp.MustCompile(`(?i)^\s*(-?\d+(?:[.,]\d+)?)\s*([^\s\d]\S*?)(?:\s+(?:(?:в|во|to|in)\s+)?(\S+?))?\s*\??$`)
+	// convertTextRe matches free-text requests like "100 usd в рублях", the target is required
+	convertTextRe = regexp.MustCompile(`(?i)^\s*(-?\d+(?:[.,]\d+)?)\s*([^\s\d]\S*?)\s+(?:в|во|to|in)\s+(\S+?)\s*\??$`)
+)
+
+// currencyAliases map lower-case currency names and symbols to currency codes
+var currencyAliases = map[string]string{
+	"₽": "RUB", "р": "RUB", "руб": "RUB", "рубль": "RUB", "рубля": "RUB", "рублей": "RUB", "рублях": "RUB", "рубли": "RUB",
+	"$": "USD", "доллар": "USD", "доллара": "USD", "долларов": "USD", "долларах": "USD", "доллары": "USD", "бакс": "USD", "баксов": "USD",
+	"€": "EUR", "евро": "EUR",
+	"£": "GBP", "фунт": "GBP", "фунта": "GBP", "фунтов": "GBP", "фунтах": "GBP", "фунты": "GBP",
+	"¥": "CNY", "юань": "CNY", "юаня": "CNY", "юаней": "CNY", "юанях": "CNY",
+	"₸": "KZT", "тенге": "KZT",
+	"₺": "TRY", "лира": "TRY", "лиры": "TRY", "лир": "TRY", "лирах": "TRY",
+	"лари": "GEL",
+	"драм": "AMD", "драма": "AMD", "драмов": "AMD", "драмах": "AMD",
+	"биткоин": "BTC", "биткоина": "BTC", "биткоинов": "BTC", "биткоинах": "BTC",
+}
+
+// convert handles /convert <amount> <from> [to] for currencies and units
+func convert(b *Bot, msg *tgbotapi.Message) {
+	msgConfig := tgbotapi.NewMessage(msg.Chat.ID, convertUsage)
+	msgConfig.ReplyToMessageID = msg.MessageID
+
+	if m := convertArgsRe.FindStringSubmatch(msg.CommandArguments()); m != nil {
+		text, err := b.convertAmount(m[1], m[2], m[3])
+		if err != nil {
+			slog.Info("could not convert", "args", msg.CommandArguments(), "err", err)
+			msgConfig.Text = "Не удалось пересчитать: " + err.Error()
+		} else {
+			msgConfig.Text = text
+		}
+	}
+	b.sendMessage(msgConfig)
+}
+
+// tryConvertText answers free-text conversion requests, false is returned if the text is not one
+func (b *Bot) tryConvertText(msg *tgbotapi.Message) bool {
+	m := convertTextRe.FindStringSubmatch(msg.Text)
+	if m == nil {
+		return false
+	}
+	text, err := b.convertAmount(m[1], m[2], m[3])
+	if err != nil {
+		slog.Debug("text is not a conversion request", "text", msg.Text, "err", err)
+		return false
+	}
+	metrics.CommandCallsCaounter.With(prometheus.Labels{"command": "/convert"}).Inc()
+	b.replyTo(msg, text)
+	return true
+}
+
+// convertAmount converts the amount between units or currencies, to may be empty
+func (b *Bot) convertAmount(amountStr, from, to string) (string, error) {
+	amount, err := strconv.ParseFloat(strings.Replace(amountStr, ",", ".", 1), 64)
+	if err != nil {
+		return "", fmt.Errorf("неверное количество %s", amountStr)
+	}
+
+	// Names like "фунт" are both a unit and a currency, they are read as a currency when converted into one
+	_, isFromUnit := units.Lookup(from)
+	_, isToUnit := units.Lookup(to)
+	if isFromUnit && (to == "" || isToUnit) {
+		result, fromUnit, toUnit, err := units.Convert(amount, from, to)
+		if err != nil {
+			return "", fmt.Errorf("неизвестная единица или разные величины")
+		}
+		return fmt.Sprintf("%s %s = %s %s", formatNumber(amount), fromUnit.Symbol, formatNumber(result), toUnit.Symbol), nil
+	}
+
+	fromCode := currencyCode(from)
+	toCode := currencyCode(to)
+	if toCode == "" {
+		toCode = "RUB"
+		if fromCode == "RUB" {
+			toCode = "USD"
+		}
+	}
+	quote, err := b.ExchangeAPI.PairRate(apiclient.CurrencyPair{Base: fromCode, Quote: toCode}, time.Now().UTC())
+	if err != nil {
+		slog.Info("could not get currency pair rate", "from", fromCode, "to", toCode, "err", err)
+		return "", fmt.Errorf("неизвестная валюта или единица")
+	}
+	return fmt.Sprintf(
+		"%s %s = %s %s\nКурс на %s, %s",
+		formatNumber(amount), fromCode, formatNumber(amount*quote.Rate), toCode,
+		quote.Time.UTC().Format("02.01.2006 15:04 MST"), rateSourceName(quote.Source),
+	), nil
+}
+
+// currencyCode resolves a currency name or symbol into an upper-case code
+func currencyCode(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if code, ok := currencyAliases[name]; ok {
+		return code
+	}
+	return strings.ToUpper(name)
+}
+
+// formatNumber rounds large numbers to cents and keeps 4 significant digits of small ones
+func formatNumber(v float64) string {
+	if math.Abs(v) >= 1 || v == 0 {
+		return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+	}
+	digits := 3 - int(math.Floor(math.Log10(math.Abs(v))))
+	return strings.TrimRight(strconv.FormatFloat(v, 'f', digits, 64), "0")
+}
@@ -0,0 +1,239 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/rahfar/familybot/src/apiclient"
+	"github.com/rahfar/familybot/src/db"
+	"github.com/rahfar/familybot/src/metrics"
+)
+
+const (
+	currencyAlertInterval = time.Hour
+	// A triggered threshold alert is re-armed only after the rate moves back by this share of the threshold
+	currencyAlertHysteresis = 0.005
+)
+
+const alertUsage = "Использование:\n" +
+	"/alert list - список оповещений\n" +
+	"/alert add <пара> above|below <курс> - курс выше или ниже порога, например /alert add USD/RUB above 100\n" +
+	"/alert add <пара> change <процент> - изменение за сутки, например /alert add BTC/USD change 5\n" +
+	"/alert remove <номер> - удалить оповещение"
+
+func (b *Bot) currencyAlertJob() {
+	slog.Info("starting currency alert job")
+	for {
+		b.checkCurrencyAlerts()
+		time.Sleep(currencyAlertInterval)
+	}
+}
+
+// checkCurrencyAlerts compares cached exchange rates with alert thresholds and notifies chats once per crossing
+func (b *Bot) checkCurrencyAlerts() {
+	ctx := context.Background()
+	chatIDs, err := b.DBClient.GetCurrencyAlertChats(ctx)
+	if err != nil {
+		slog.Error("error getting currency alert chats", "err", err)
+		return
+	}
+	if len(chatIDs) == 0 {
+		return
+	}
+
+	now := time.Now().UTC()
+	for _, chatID := range chatIDs {
+		alerts, err := b.DBClient.GetCurrencyAlerts(ctx, chatID)
+		if err != nil {
+			slog.Error("error getting currency alerts", "err", err, "chat_id", chatID)
+			continue
+		}
+
+		text := ""
+		for i := range alerts {
+			a := &alerts[i]
+			pair, err := apiclient.ParseCurrencyPair(a.Pair)
+			if err != nil {
+				slog.Warn("invalid currency pair", "pair", a.Pair, "chat_id", chatID)
+				continue
+			}
+			quotes, err := b.ExchangeAPI.PairQuotes(pair, now, now.AddDate(0, 0, -1))
+			if err != nil || (a.Kind == "change" && quotes[1].Rate == 0) {
+				slog.Warn("could not get currency pair rates", "pair", a.Pair, "err", err)
+				continue
+			}
+			rate, before := quotes[0].Rate, quotes[1].Rate
+
+			crossed, rearmed := evaluateCurrencyAlert(*a, rate, before)
+			switch {
+			case !a.Triggered && crossed:
+				// Without the saved state the same crossing would be reported again
+				if err := b.DBClient.SetCurrencyAlertTriggered(ctx, chatID, a.ID, true); err != nil {
+					slog.Error("error saving currency alert state", "err", err, "chat_id", chatID, "alert_id", a.ID)
+					continue
+				}
+				text += formatCurrencyAlertEvent(*a, pair, rate, before) + " — " + rateSourceName(quotes[0].Source) + "\n"
+			case a.Triggered && rearmed:
+				if err := b.DBClient.SetCurrencyAlertTriggered(ctx, chatID, a.ID, false); err != nil {
+					slog.Error("error saving currency alert state", "err", err, "chat_id", chatID, "alert_id", a.ID)
+				}
+			}
+		}
+
+		if len(text) == 0 {
+			continue
+		}
+
+		metrics.CurrencyAlertCounter.Inc()
+		b.sendMessage(tgbotapi.NewMessage(chatID, "💱 Курсы валют\n"+text))
+	}
+}
+
+// evaluateCurrencyAlert reports if the alert threshold is crossed and if the rate is back past the hysteresis band
+func evaluateCurrencyAlert(a db.CurrencyAlert, rate, before float64) (crossed, rearmed bool) {
+	switch a.Kind {
+	case "above":
+		return rate >= a.Value, rate < a.Value*(1-currencyAlertHysteresis)
+	case "below":
+		return rate <= a.Value, rate > a.Value*(1+currencyAlertHysteresis)
+	case "change":
+		change := math.Abs(rate/before-1) * 100
+		return change >= a.Value, change < a.Value/2
+	}
+	return false, false
+}
+
+func formatCurrencyAlertEvent(a db.CurrencyAlert, pair apiclient.CurrencyPair, rate, before float64) string {
+	switch a.Kind {
+	case "above":
+		return fmt.Sprintf("📈 %s выше %s: %s", pair, formatNumber(a.Value), formatPrice(rate, pair.Quote))
+	case "below":
+		return fmt.Sprintf("📉 %s ниже %s: %s", pair, formatNumber(a.Value), formatPrice(rate, pair.Quote))
+	default:
+		return fmt.Sprintf("↕️ %s изменился на %+.2f%% за сутки: %s", pair, (rate/before-1)*100, formatPrice(rate, pair.Quote))
+	}
+}
+
+// manageCurrencyAlerts handles /alert add|list|remove
+func manageCurrencyAlerts(b *Bot, msg *tgbotapi.Message) {
+	ctx := context.Background()
+	chatID := msg.Chat.ID
+	alerts, err := b.DBClient.GetCurrencyAlerts(ctx, chatID)
+	if err != nil {
+		slog.Error("error getting currency alerts", "err", err, "chat_id", chatID)
+		b.replyTo(msg, "Ошибка при получении оповещений")
+		return
+	}
+
+	args := strings.Fields(msg.CommandArguments())
+	switch {
+	case len(args) == 0 || (args[0] == "list" && len(args) == 1):
+		b.replyTo(msg, formatCurrencyAlerts(alerts))
+		return
+	case args[0] == "add" && len(args) == 4:
+		alert, parseErr := parseCurrencyAlert(args[1:])
+		if parseErr != nil {
+			b.replyTo(msg, parseErr.Error())
+			return
+		}
+		pair, _ := apiclient.ParseCurrencyPair(alert.Pair)
+		quote, rateErr := b.ExchangeAPI.PairRate(pair, time.Now().UTC())
+		if rateErr != nil {
+			slog.Info("could not get currency pair rate", "pair", pair, "err", rateErr)
+			b.replyTo(msg, fmt.Sprintf("Нет курса для пары %s", pair))
+			return
+		}
+		rate := quote.Rate
+		// A threshold that is already crossed is reported only after the rate returns
+		alert.Triggered, _ = evaluateCurrencyAlert(alert, rate, rate)
+		for _, a := range alerts {
+			alert.ID = max(alert.ID, a.ID)
+		}
+		alert.ID++
+		err = b.DBClient.SetCurrencyAlerts(ctx, chatID, append(alerts, alert))
+		if err == nil {
+			err = b.DBClient.SetCurrencyAlertTriggered(ctx, chatID, alert.ID, alert.Triggered)
+		}
+		if err == nil {
+			b.replyTo(msg, fmt.Sprintf("Оповещение %d добавлено, текущий курс %s", alert.ID, formatPrice(rate, pair.Quote)))
+			return
+		}
+	case args[0] == "remove" && len(args) == 2:
+		id, parseErr := strconv.Atoi(args[1])
+		i := slices.IndexFunc(alerts, func(a db.CurrencyAlert) bool { return a.ID == id })
+		if parseErr != nil || i < 0 {
+			b.replyTo(msg, fmt.Sprintf("Оповещение %s не найдено", args[1]))
+			return
+		}
+		err = b.DBClient.SetCurrencyAlerts(ctx, chatID, slices.Delete(alerts, i, i+1))
+		if err == nil {
+			// IDs of removed alerts are reused, so their state must not stay behind
+			err = b.DBClient.SetCurrencyAlertTriggered(ctx, chatID, id, false)
+		}
+		if err == nil {
+			b.replyTo(msg, "Оповещение удалено")
+			return
+		}
+	default:
+		b.replyTo(msg, alertUsage)
+		return
+	}
+
+	slog.Error("error saving currency alerts", "err", err, "chat_id", chatID)
+	b.replyTo(msg, "Ошибка при сохранении оповещений")
+}
+
+// parseCurrencyAlert parses "<pair> above|below|change <value>"
+func parseCurrencyAlert(args []string) (db.CurrencyAlert, error) {
+	pair, err := apiclient.ParseCurrencyPair(args[0])
+	if err != nil {
+		return db.CurrencyAlert{}, fmt.Errorf("неверная пара, пример: USD/RUB")
+	}
+	kind := strings.ToLower(args[1])
+	switch kind {
+	case ">", "выше":
+		kind = "above"
+	case "<", "ниже":
+		kind = "below"
+	case "%":
+		kind = "change"
+	}
+	if kind != "above" && kind != "below" && kind != "change" {
+		return db.CurrencyAlert{}, fmt.Errorf("%s", alertUsage)
+	}
+	value, err := strconv.ParseFloat(strings.TrimSuffix(strings.Replace(args[2], ",", ".", 1), "%"), 64)
+	if err != nil || value <= 0 {
+		return db.CurrencyAlert{}, fmt.Errorf("неверное значение")
+	}
+	return db.CurrencyAlert{Pair: pair.String(), Kind: kind, Value: value}, nil
+}
+
+func formatCurrencyAlerts(alerts []db.CurrencyAlert) string {
+	if len(alerts) == 0 {
+		return "Оповещений нет\n\n" + alertUsage
+	}
+	text := "Оповещения о курсах:\n"
+	for _, a := range alerts {
+		switch a.Kind {
+		case "above":
+			text += fmt.Sprintf("%d. %s выше %s", a.ID, a.Pair, formatNumber(a.Value))
+		case "below":
+			text += fmt.Sprintf("%d. %s ниже %s", a.ID, a.Pair, formatNumber(a.Value))
+		default:
+			text += fmt.Sprintf("%d. %s изменение за сутки от %s%%", a.ID, a.Pair, formatNumber(a.Value))
+		}
+		if a.Triggered {
+			text += " (сработало)"
+		}
+		text += "\n"
+	}
+	return text
+}
@@ -0,0 +1,354 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/rahfar/familybot/src/apiclient"
+	"github.com/rahfar/familybot/src/db"
+	"github.com/rahfar/familybot/src/metrics"
+)
+
+// minPollenCount is the pollen concentration, grains/m³, from which allergy sufferers start to notice it
+const minPollenCount = 10
+
+var weekdaysShort = [...]string{"Вс", "Пн", "Вт", "Ср", "Чт", "Пт", "Сб"}
+
+// mourningDigest renders the morning digest, news in posted are skipped and the shown ones are added to it
+func (b *Bot) mourningDigest(posted *postedNews) string {
+	text := "Доброе утро\\! 🌅\n"
+
+	text += b.currencyDigest("Курсы валют", b.formatRates(b.GroupID, rateDeltaPeriods))
+
+	// call weather api
+	weather := b.WeatherAPI.GetChatWeather(b.GroupID)
+	if len(weather) > 0 {
+		text += "\n_Прогноз погоды:_\n"
+		for _, w := range weather {
+			text += b.formatWeatherBlock(w)
+		}
+	}
+
+	text += b.newsDigest("Последние новости", posted, b.NewsAPI.GetLatestNews)
+	return text
+}
+
+// eveningDigest renders the evening digest, news in posted are skipped and the shown ones are added to it
+func (b *Bot) eveningDigest(posted *postedNews) string {
+	text := "Добрый вечер\\! 🌙\n"
+
+	// tomorrow's forecast in the local time of every city
+	weather := b.WeatherAPI.GetChatWeather(b.GroupID)
+	forecast := ""
+	for _, w := range weather {
+		d := apiclient.NewWeatherSummary(w).Day(1)
+		if d == nil {
+			continue
+		}
+		forecast += fmt.Sprintf("*%s:*\n", tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, w.Place.Name))
+		forecast += tgbotapi.EscapeText(
+			tgbotapi.ModeMarkdownV2,
+			fmt.Sprintf(
+				"  min: %d°C, max: %d°C, %s%s\n",
+				int(d.MinTemp),
+				int(d.MaxTemp),
+				d.Condition.Description,
+				formatPrecipitation(d.Precipitation),
+			),
+		)
+	}
+	if len(forecast) > 0 {
+		text += "\n_Прогноз погоды на завтра:_\n" + forecast
+	}
+
+	text += b.currencyDigest("Курсы валют за день", b.formatRates(b.GroupID, rateDeltaPeriods[:1]))
+	text += b.newsDigest("Непрочитанные новости", posted, b.NewsAPI.GetUnreadNews)
+	return text
+}
+
+func (b *Bot) weeklyDigest() string {
+	text := "Итоги недели\\! 📅\n"
+
+	weather := b.WeatherAPI.GetChatWeather(b.GroupID)
+	if len(weather) > 0 {
+		// OpenWeather forecasts only 5 days ahead, Open-Meteo a full week
+		title := "Прогноз погоды на неделю"
+		for _, w := range weather {
+			if len(apiclient.NewWeatherSummary(w).Days) < 7 {
+				title = "Прогноз погоды на ближайшие дни"
+			}
+		}
+		text += "\n_" + title + ":_\n"
+		for _, w := range weather {
+			text += fmt.Sprintf("*%s:*\n", tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, w.Place.Name))
+			for _, d := range apiclient.NewWeatherSummary(w).Days {
+				text += tgbotapi.EscapeText(
+					tgbotapi.ModeMarkdownV2,
+					fmt.Sprintf(
+						"  %s %s: %d..%d°C, %s%s\n",
+						weekdaysShort[d.Date.Weekday()],
+						d.Date.Format("02.01"),
+						int(d.MinTemp),
+						int(d.MaxTemp),
+						d.Condition.Description,
+						formatPrecipitation(d.Precipitation),
+					),
+				)
+			}
+		}
+	}
+
+	text += b.currencyDigest("Курсы валют за неделю", b.formatWeeklyRates(b.GroupID))
+
+	weekAgo := time.Now().Add(-7 * 24 * time.Hour)
+	text += b.newsDigest("Самое читаемое за неделю", nil, func(ctx context.Context, source db.NewsSource) ([]apiclient.NewsEntry, error) {
+		return b.NewsAPI.GetMostReadNews(ctx, source, weekAgo)
+	})
+	return text
+}
+
+// currencyDigest renders the section of rendered rates under the title, nothing is shown if rates are not available
+func (b *Bot) currencyDigest(title, rates string) string {
+	if rates == "" {
+		return ""
+	}
+	return "\n_" + title + ":_\n" + rates
+}
+
+// newsDigest renders headlines of the group's news sources fetched with the given function,
+// sources without fresh items are left out. Entries in the posted record are skipped and shown ones are added,
+// a nil record turns deduplication off
+func (b *Bot) newsDigest(title string, posted *postedNews, fetch func(ctx context.Context, source db.NewsSource) ([]apiclient.NewsEntry, error)) string {
+	ctx := context.Background()
+	sources, err := b.DBClient.GetNewsSources(ctx, b.GroupID)
+	if err != nil {
+		slog.Error("error getting news sources", "err", err, "chat_id", b.GroupID)
+		return ""
+	}
+
+	fmt_news := ""
+	i := 1
+	for _, s := range sources {
+		query := s
+		if posted != nil {
+			query.Count *= newsDedupFetchFactor
+		}
+		news, err := fetch(ctx, query)
+		if err != nil {
+			slog.Error("error calling news api", "source", s.Label, "err", err)
+			continue
+		}
+		if posted != nil {
+			news = slices.DeleteFunc(news, func(n apiclient.NewsEntry) bool {
+				if posted.postedEntry(n) {
+					metrics.NewsDedupCounter.With(prometheus.Labels{"match": "id"}).Inc()
+					return true
+				}
+				return false
+			})
+		}
+		// Titles are translated in batches of entries that are still needed, skipped ones make another batch
+		titles := make([]string, 0, len(news))
+		shown := 0
+		for j, n := range news {
+			if shown == s.Count {
+				break
+			}
+			if j == len(titles) {
+				titles = append(titles, b.translateTitles(ctx, news[j:min(len(news), j+s.Count-shown)], s.Translate)...)
+			}
+			newsTitle := titles[j]
+			if posted != nil {
+				if posted.postedTitle(newsTitle) {
+					slog.Debug("skip posted news", "source", s.Label, "entry_id", n.ID)
+					metrics.NewsDedupCounter.With(prometheus.Labels{"match": "title"}).Inc()
+					continue
+				}
+				posted.add(n, newsTitle)
+			}
+			if shown == 0 {
+				fmt_news += tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, s.Label) + "\n"
+			}
+			shown++
+			newsTitle = tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, newsTitle)
+			escaped_url := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, n.URL)
+			fmt_news += fmt.Sprintf("%d\\. [%s](%s)\n", i, newsTitle, escaped_url)
+			if s.Summarize {
+				summary, err := b.Summarizer.SummarizeEntry(ctx, n)
+				if err != nil {
+					slog.Error("error summarizing news entry", "err", err, "entry_id", n.ID)
+				} else {
+					fmt_news += "_" + tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, summary) + "_\n"
+				}
+			}
+			i++
+		}
+	}
+	if fmt_news == "" {
+		return ""
+	}
+	return "\n_" + title + ":_\n" + fmt_news
+}
+
+// translateTitles translates titles of the entries with one DeepL request, titles stay in the original
+// language if lang is empty or the translation fails
+func (b *Bot) translateTitles(ctx context.Context, entries []apiclient.NewsEntry, lang string) []string {
+	titles := make([]string, 0, len(entries))
+	for _, e := range entries {
+		titles = append(titles, e.Title)
+	}
+	if lang == "" || len(titles) == 0 {
+		return titles
+	}
+	translations, err := b.DeeplAPI.Translate(ctx, titles, apiclient.TranslateOptions{TargetLang: lang})
+	if err != nil {
+		slog.Error("error calling deepl api", "err", err)
+		return titles
+	}
+	for i, t := range translations {
+		titles[i] = t.Text
+	}
+	return titles
+}
+
+func (b *Bot) sendDigest(text string) {
+	// send message to group
+	msg := tgbotapi.NewMessage(b.GroupID, text)
+	msg.ParseMode = tgbotapi.ModeMarkdownV2
+	msg.DisableWebPagePreview = true
+
+	b.sendMessage(msg)
+}
+
+func (b *Bot) mourningJob() {
+	metrics.MourningJobCounter.Inc()
+	slog.Info("starting mourning job")
+	for {
+		waitUntil("mourning", nextDailyTime(7, 0))
+		posted := b.loadPostedNews(context.Background(), b.GroupID)
+		b.sendDigest(b.mourningDigest(posted))
+		b.savePostedNews(context.Background(), b.GroupID, posted)
+	}
+}
+
+func (b *Bot) eveningJob() {
+	metrics.EveningJobCounter.Inc()
+	slog.Info("starting evening job")
+	for {
+		waitUntil("evening", nextDailyTime(20, 0))
+		posted := b.loadPostedNews(context.Background(), b.GroupID)
+		b.sendDigest(b.eveningDigest(posted))
+		b.savePostedNews(context.Background(), b.GroupID, posted)
+	}
+}
+
+func (b *Bot) weeklyJob() {
+	metrics.WeeklyJobCounter.Inc()
+	slog.Info("starting weekly job")
+	for {
+		waitUntil("weekly", nextWeeklyTime(time.Sunday, 11, 0))
+		b.sendDigest(b.weeklyDigest())
+	}
+}
+
+// nextDailyTime returns the nearest future moment with the given local time
+func nextDailyTime(hour, minute int) time.Time {
+	t := time.Now()
+	desiredTime := time.Date(t.Year(), t.Month(), t.Day(), hour, minute, 0, 0, t.Location())
+	if desiredTime.Sub(t) <= 5*time.Second {
+		desiredTime = desiredTime.AddDate(0, 0, 1)
+	}
+	return desiredTime
+}
+
+// nextWeeklyTime returns the nearest future moment with the given weekday and local time
+func nextWeeklyTime(weekday time.Weekday, hour, minute int) time.Time {
+	desiredTime := nextDailyTime(hour, minute)
+	for desiredTime.Weekday() != weekday {
+		desiredTime = desiredTime.AddDate(0, 0, 1)
+	}
+	return desiredTime
+}
+
+func waitUntil(job string, desiredTime time.Time) {
+	timeToWait := time.Until(desiredTime)
+	slog.Info("waiting until "+job, "time-to-wait", timeToWait.String())
+	time.Sleep(timeToWait)
+}
+
+// formatWeatherBlock renders current weather of a city as it is shown in the digest
+func (b *Bot) formatWeatherBlock(w apiclient.Forecast) string {
+	summary := apiclient.NewWeatherSummary(w)
+	today := summary.Today()
+	text := fmt.Sprintf("*%s:*\n", tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, summary.City))
+	text += tgbotapi.EscapeText(
+		tgbotapi.ModeMarkdownV2,
+		fmt.Sprintf(
+			"  %d°C (min: %d°C, max: %d°C), %s%s\n  восход: %s закат: %s, световой день %s\n",
+			int(summary.Current.Temp),
+			int(today.MinTemp),
+			int(today.MaxTemp),
+			summary.Current.Condition.Description,
+			formatPrecipitation(today.Precipitation),
+			summary.Sunrise.Format("15:04"),
+			summary.Sunset.Format("15:04"),
+			formatDaylight(today.Daylight),
+		),
+	)
+	if aq, err := b.WeatherAPI.GetAirQuality(w.Place.Lat, w.Place.Lon); err != nil {
+		slog.Warn("could not get air quality", "city", summary.City, "err", err)
+	} else {
+		text += tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, formatAirQuality(*aq))
+	}
+	return text
+}
+
+// formatAirQuality renders a compact air quality line, poor air is marked with a warning.
+// UV index and pollen follow on a separate line when they are known, pollen below minPollenCount is left out
+func formatAirQuality(aq apiclient.AirQuality) string {
+	warning := ""
+	if aq.AQI >= 4 {
+		warning = " ⚠️"
+	}
+	text := fmt.Sprintf(
+		"  воздух: %s %s (AQI %d), PM2.5 %.0f, PM10 %.0f, O₃ %.0f мкг/м³%s\n",
+		aq.Emoji(), aq.Level(), aq.AQI, aq.PM25, aq.PM10, aq.O3, warning,
+	)
+
+	extra := make([]string, 0, 2)
+	if aq.UVIndex != nil {
+		extra = append(extra, fmt.Sprintf("УФ-индекс до %.0f (%s)", *aq.UVIndex, aq.UVLevel()))
+	}
+	pollen := make([]string, 0, len(aq.Pollen))
+	for _, p := range aq.Pollen {
+		if p.Count >= minPollenCount {
+			pollen = append(pollen, fmt.Sprintf("%s %.0f", p.Plant, p.Count))
+		}
+	}
+	if len(pollen) > 0 {
+		extra = append(extra, "пыльца: "+strings.Join(pollen, ", ")+" зерен/м³")
+	}
+	if len(extra) > 0 {
+		text += "  " + strings.Join(extra, ", ") + "\n"
+	}
+	return text
+}
+
+// formatPrecipitation renders the total precipitation of a day if there is any
+func formatPrecipitation(volume float64) string {
+	if volume < 0.1 {
+		return ""
+	}
+	return fmt.Sprintf(", осадки %.1f мм", volume)
+}
+
+func formatDaylight(d time.Duration) string {
+	return fmt.Sprintf("%dч %02dм", int(d.Hours()), int(d.Minutes())%60)
+}
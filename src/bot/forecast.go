@@ -0,0 +1,225 @@
+package bot
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/rahfar/familybot/src/apiclient"
+	"github.com/rahfar/familybot/src/chart"
+)
+
+const (
+	maxForecastDays   = 5
+	maxCaptionLength  = 1024
+	forecastChartName = "forecast.png"
+)
+
+// chartMarkers are emoji matching chart.Palette colors, used as a legend in captions
+var chartMarkers = []string{"🔴", "🔵", "🟢", "🟠", "🟣", "🟤", "⚫", "🟡"}
+
+// getForecast sends a temperature chart for /forecast [city] [days]
+func getForecast(b *Bot, msg *tgbotapi.Message) {
+	query, days := parseForecastArgs(msg.CommandArguments())
+	if len(query) == 0 {
+		weather := b.WeatherAPI.GetChatWeather(msg.Chat.ID)
+		b.sendForecastChart(msg.Chat.ID, msg.MessageID, weather, days)
+		return
+	}
+
+	locations, err := b.WeatherAPI.Geocode(query)
+	if err != nil {
+		slog.Error("error calling geocoding api", "err", err, "query", query)
+		b.replyTo(msg, "Ошибка при поиске города")
+		return
+	}
+
+	switch len(locations) {
+	case 0:
+		b.replyTo(msg, "Город не найден")
+	case 1:
+		b.sendPlaceForecast(msg.Chat.ID, msg.MessageID, locations[0].Lat, locations[0].Lon, locations[0].LocalName(), days)
+	default:
+		rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(locations))
+		for _, l := range locations {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(formatGeoLocation(l), fmt.Sprintf("forecast:%.4f:%.4f:%d", l.Lat, l.Lon, days)),
+			))
+		}
+		msgConfig := tgbotapi.NewMessage(msg.Chat.ID, "Уточните город:")
+		msgConfig.ReplyToMessageID = msg.MessageID
+		msgConfig.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+		b.sendMessage(msgConfig)
+	}
+}
+
+// parseForecastArgs splits /forecast arguments into the place and the number of days
+func parseForecastArgs(arguments string) (string, int) {
+	args := strings.Fields(arguments)
+	days := maxForecastDays
+	if len(args) > 0 {
+		if d, err := strconv.Atoi(args[len(args)-1]); err == nil {
+			days = min(max(d, 1), maxForecastDays)
+			args = args[:len(args)-1]
+		}
+	}
+	return strings.Join(args, " "), days
+}
+
+// onForecastCallback handles the choice of a place made with the inline keyboard
+func onForecastCallback(b *Bot, query *tgbotapi.CallbackQuery, data string) {
+	parts := strings.Split(data, ":")
+	if len(parts) != 3 {
+		slog.Error("unexpected forecast callback data", "data", data)
+		return
+	}
+	lat, err1 := strconv.ParseFloat(parts[0], 64)
+	lon, err2 := strconv.ParseFloat(parts[1], 64)
+	days, err3 := strconv.Atoi(parts[2])
+	if err1 != nil || err2 != nil || err3 != nil {
+		slog.Error("unexpected forecast callback data", "data", data)
+		return
+	}
+
+	b.deleteMessage(query.Message.Chat.ID, query.Message.MessageID)
+	replyTo, name := 0, ""
+	if request := query.Message.ReplyToMessage; request != nil {
+		replyTo = request.MessageID
+		place, _ := parseForecastArgs(request.CommandArguments())
+		name = b.chosenPlaceName(place, data)
+	}
+	b.sendPlaceForecast(query.Message.Chat.ID, replyTo, lat, lon, name, days)
+}
+
+func (b *Bot) sendPlaceForecast(chatID int64, replyTo int, lat, lon float64, name string, days int) {
+	w, err := b.WeatherAPI.GetWeatherByCoord(lat, lon)
+	if err != nil || len(w.Items) == 0 {
+		slog.Error("could not get weather", "lat", lat, "lon", lon, "err", err)
+		msgConfig := tgbotapi.NewMessage(chatID, "Нет данных")
+		msgConfig.ReplyToMessageID = replyTo
+		b.sendMessage(msgConfig)
+		return
+	}
+	if name != "" {
+		w.Place.Name = name
+	}
+	b.sendForecastChart(chatID, replyTo, []apiclient.Forecast{*w}, days)
+}
+
+// sendForecastChart renders temperature lines and precipitation probability bars
+// for the given cities and sends them with a text summary per day
+func (b *Bot) sendForecastChart(chatID int64, replyTo int, weather []apiclient.Forecast, days int) {
+	if len(weather) == 0 {
+		msgConfig := tgbotapi.NewMessage(chatID, "Нет данных")
+		msgConfig.ReplyToMessageID = replyTo
+		b.sendMessage(msgConfig)
+		return
+	}
+	if len(weather) > len(chart.Palette) {
+		weather = weather[:len(chart.Palette)]
+	}
+
+	// Day boundaries are drawn in the time zone of the first city
+	location := weather[0].Location()
+	until := time.Now().Add(time.Duration(days) * 24 * time.Hour)
+
+	c := chart.Chart{
+		YFormat: "%.0f°",
+		Labels:  make(map[time.Time]string),
+	}
+	for i, w := range weather {
+		line := chart.Series{Name: w.Place.Name, Color: chart.Palette[i]}
+		bars := chart.Series{Name: w.Place.Name, Color: chart.Palette[i]}
+		for _, item := range w.Items {
+			t := item.Time
+			if t.After(until) {
+				break
+			}
+			line.Points = append(line.Points, chart.Point{X: t, Y: item.Temp})
+			bars.Points = append(bars.Points, chart.Point{X: t, Y: item.Pop})
+		}
+		c.Lines = append(c.Lines, line)
+		c.Bars = append(c.Bars, bars)
+	}
+
+	first := weather[0].Items[0].Time.In(location)
+	day := time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, location)
+	for ; day.Before(until); day = day.AddDate(0, 0, 1) {
+		c.Separators = append(c.Separators, day)
+		c.Labels[day.Add(12*time.Hour)] = day.Format("02.01")
+	}
+
+	var buf bytes.Buffer
+	if err := c.Render(&buf); err != nil {
+		slog.Error("could not render forecast chart", "err", err)
+		msgConfig := tgbotapi.NewMessage(chatID, "Ошибка при построении графика")
+		msgConfig.ReplyToMessageID = replyTo
+		b.sendMessage(msgConfig)
+		return
+	}
+
+	legend := ""
+	for i, w := range weather {
+		legend += fmt.Sprintf("%s %s\n", chartMarkers[i], w.Place.Name)
+	}
+	summary := b.formatForecastSummary(weather, days)
+
+	photo := tgbotapi.NewPhoto(chatID, tgbotapi.FileBytes{Name: forecastChartName, Bytes: buf.Bytes()})
+	photo.ReplyToMessageID = replyTo
+	if utf8.RuneCountInString(legend+"\n"+summary) <= maxCaptionLength {
+		photo.Caption = legend + "\n" + summary
+		b.sendPhoto(photo)
+		return
+	}
+	photo.Caption = legend
+	b.sendPhoto(photo)
+	b.sendMessage(tgbotapi.NewMessage(chatID, summary))
+}
+
+// formatForecastSummary renders a short text summary of every day for every city
+func (b *Bot) formatForecastSummary(weather []apiclient.Forecast, days int) string {
+	type cityDay struct {
+		marker string
+		day    apiclient.DaySummary
+	}
+	// Cities may have different time zones, so local days are matched by their calendar date
+	byDay := make(map[string][]cityDay)
+	dates := make([]time.Time, 0)
+	for i, w := range weather {
+		for j, d := range apiclient.NewWeatherSummary(w).Days {
+			if j >= days {
+				break
+			}
+			key := d.Date.Format("2006-01-02")
+			if _, ok := byDay[key]; !ok {
+				dates = append(dates, d.Date)
+			}
+			byDay[key] = append(byDay[key], cityDay{marker: chartMarkers[i], day: d})
+		}
+	}
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Format("2006-01-02") < dates[j].Format("2006-01-02") })
+
+	text := ""
+	for _, date := range dates {
+		text += fmt.Sprintf("%s %s\n", weekdaysShort[date.Weekday()], date.Format("02.01"))
+		for _, cd := range byDay[date.Format("2006-01-02")] {
+			text += fmt.Sprintf(
+				"%s %d..%d°C, %s, вероятность осадков %d%%%s\n",
+				cd.marker,
+				int(cd.day.MinTemp),
+				int(cd.day.MaxTemp),
+				cd.day.Condition.Description,
+				int(cd.day.Pop*100),
+				formatPrecipitation(cd.day.Precipitation),
+			)
+		}
+	}
+	return text
+}
@@ -0,0 +1,153 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/rahfar/familybot/src/apiclient"
+	"github.com/rahfar/familybot/src/db"
+)
+
+const glossaryUsage = "Использование:\n" +
+	"/glossary - глоссарии DeepL по языковым парам\n" +
+	"/glossary <исх>><язык> - термины глоссария, например /glossary en>ru\n" +
+	"/glossary <исх>><язык> add <термин> = <перевод> - добавить или заменить термин\n" +
+	"/glossary <исх>><язык> remove <термин> - удалить термин\n" +
+	"/glossary <исх>><язык> delete - удалить глоссарий\n" +
+	"/glossary sync - пересоздать глоссарии в DeepL"
+
+// manageGlossary shows and changes DeepL glossaries, terms are stored in Redis and every change
+// recreates the glossary of the language pair in DeepL
+func manageGlossary(b *Bot, msg *tgbotapi.Message) {
+	ctx := context.Background()
+	if !b.isUserAdmin(msg.From.ID) {
+		b.replyTo(msg, "У вас нет прав для выполнения этой команды")
+		return
+	}
+
+	args := strings.TrimSpace(msg.CommandArguments())
+	if args == "" {
+		b.replyTo(msg, b.formatGlossaries(ctx))
+		return
+	}
+	if args == "sync" {
+		if err := b.DeeplAPI.SyncGlossaries(ctx); err != nil {
+			slog.Error("error syncing deepl glossaries", "err", err)
+			b.replyTo(msg, "Ошибка при синхронизации глоссариев с DeepL")
+			return
+		}
+		b.replyTo(msg, b.formatGlossaries(ctx))
+		return
+	}
+
+	pairArg, rest, _ := strings.Cut(args, " ")
+	m := langPairRe.FindStringSubmatch(pairArg)
+	if m == nil || m[1] == "" || strings.Contains(m[2], "-") {
+		b.replyTo(msg, glossaryUsage)
+		return
+	}
+	pair := db.GlossaryPair(m[1], m[2])
+	action, term, _ := strings.Cut(strings.TrimSpace(rest), " ")
+	term = strings.TrimSpace(term)
+	// Glossaries of pairs that were added before the check can still be deleted
+	if action != "delete" && (!apiclient.DeeplSupports(m[1]) || !apiclient.DeeplSupports(m[2])) {
+		b.replyTo(msg, "DeepL не поддерживает пару "+pair+", глоссарии работают только для языков DeepL")
+		return
+	}
+
+	var err error
+	switch {
+	case action == "":
+		entries, err := b.DBClient.GetGlossaryEntries(ctx, pair)
+		if err != nil {
+			slog.Error("error getting glossary entries", "err", err, "pair", pair)
+			b.replyTo(msg, "Ошибка при получении глоссария")
+			return
+		}
+		b.replyTo(msg, formatGlossaryEntries(pair, entries))
+		return
+	case action == "add":
+		source, target, found := strings.Cut(term, "=")
+		source, target = strings.TrimSpace(source), strings.TrimSpace(target)
+		// DeepL glossaries are uploaded as TSV, so terms cannot contain tabs or line breaks
+		if !found || source == "" || target == "" || strings.ContainsAny(source+target, "\t\n\r") {
+			b.replyTo(msg, glossaryUsage)
+			return
+		}
+		err = b.DBClient.SetGlossaryEntry(ctx, pair, source, target)
+	case action == "remove" && term != "":
+		var removed bool
+		removed, err = b.DBClient.DeleteGlossaryEntry(ctx, pair, term)
+		if err == nil && !removed {
+			b.replyTo(msg, fmt.Sprintf("Термин «%s» не найден в глоссарии %s", term, pair))
+			return
+		}
+	case action == "delete" && term == "":
+		err = b.DBClient.DeleteGlossaryEntries(ctx, pair)
+	default:
+		b.replyTo(msg, glossaryUsage)
+		return
+	}
+	if err != nil {
+		slog.Error("error saving glossary", "err", err, "pair", pair)
+		b.replyTo(msg, "Ошибка при сохранении глоссария")
+		return
+	}
+
+	if err := b.DeeplAPI.SyncGlossary(ctx, pair); err != nil {
+		slog.Error("error syncing deepl glossary", "err", err, "pair", pair)
+		b.replyTo(msg, "Глоссарий сохранен, но DeepL его не принял, повторить - /glossary sync")
+		return
+	}
+	b.replyTo(msg, "Глоссарий "+pair+" обновлен")
+}
+
+func (b *Bot) formatGlossaries(ctx context.Context) string {
+	pairs, err := b.DBClient.GetGlossaryPairs(ctx)
+	if err != nil {
+		slog.Error("error getting glossary pairs", "err", err)
+		return "Ошибка при получении глоссариев"
+	}
+	if len(pairs) == 0 {
+		return "Глоссариев нет\n\n" + glossaryUsage
+	}
+	ids, err := b.DBClient.GetGlossaryIDs(ctx)
+	if err != nil {
+		slog.Error("error getting glossary ids", "err", err)
+	}
+
+	text := "Глоссарии DeepL:\n"
+	for _, pair := range pairs {
+		entries, err := b.DBClient.GetGlossaryEntries(ctx, pair)
+		if err != nil {
+			slog.Error("error getting glossary entries", "err", err, "pair", pair)
+		}
+		status := "не создан в DeepL"
+		if id, ok := ids[pair]; ok {
+			status = "id " + id
+		}
+		text += fmt.Sprintf("%s: %d терминов, %s\n", pair, len(entries), status)
+	}
+	return text
+}
+
+func formatGlossaryEntries(pair string, entries map[string]string) string {
+	if len(entries) == 0 {
+		return "Глоссарий " + pair + " пуст\n\n" + glossaryUsage
+	}
+	terms := make([]string, 0, len(entries))
+	for term := range entries {
+		terms = append(terms, term)
+	}
+	slices.Sort(terms)
+	text := "Глоссарий " + pair + ":\n"
+	for _, term := range terms {
+		text += term + " = " + entries[term] + "\n"
+	}
+	return text
+}
@@ -11,7 +11,6 @@ import (
 	"net/http"
 	"os"
 	"path"
-	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -29,44 +28,6 @@ func ping(b *Bot, msg *tgbotapi.Message) {
 	b.sendMessage(msgConfig)
 }
 
-func getCurrentWeather(b *Bot, msg *tgbotapi.Message) {
-	msgConfig := tgbotapi.NewMessage(msg.Chat.ID, "")
-	weather := b.WeatherAPI.GetWeather()
-	sort.Slice(weather, func(i, j int) bool {
-		return weather[i].List[0].Main.Temp < weather[j].List[0].Main.Temp
-	})
-	if len(weather) > 0 {
-		for _, w := range weather {
-			location := time.FixedZone("custom", w.City.Timezone)
-			sunriseTime := time.Unix(w.City.Sunrise, 0).In(location).Format("15:04")
-			sunsetTime := time.Unix(w.City.Sunset, 0).In(location).Format("15:04")
-			minTemp, maxTemp := b.WeatherAPI.GetMinMaxTemp(w)
-			msgConfig.Text += fmt.Sprintf("*%s:*\n", w.City.Name)
-			msgConfig.Text += tgbotapi.EscapeText(
-				tgbotapi.ModeMarkdownV2,
-				fmt.Sprintf(
-					"  %d°C (min: %d°C, max: %d°C), %s\n  восход: %s закат: %s\n",
-					int(w.List[0].Main.Temp),
-					int(minTemp),
-					int(maxTemp),
-					w.List[0].Weather[0].Description,
-					sunriseTime,
-					sunsetTime,
-				),
-			)
-		}
-		msgConfig.ReplyToMessageID = msg.MessageID
-		msgConfig.ParseMode = tgbotapi.ModeMarkdownV2
-		b.sendMessage(msgConfig)
-		return
-	} else {
-		msgConfig = tgbotapi.NewMessage(msg.Chat.ID, "Нет данных")
-		msgConfig.ReplyToMessageID = msg.MessageID
-		b.sendMessage(msgConfig)
-		return
-	}
-}
-
 func getRevision(b *Bot, msg *tgbotapi.Message) {
 	rev := os.Getenv("REVISION")
 	if len(rev) == 0 {
@@ -87,8 +48,26 @@ func whoAmI(b *Bot, msg *tgbotapi.Message) {
 	b.sendMessage(msgConfig)
 }
 
+// sendMourningDigest previews the morning digest, news shown in it are not recorded as posted
 func sendMourningDigest(b *Bot, msg *tgbotapi.Message) {
-	text := b.mourningDigest()
+	text := b.mourningDigest(b.loadPostedNews(context.Background(), b.GroupID))
+	msgConfig := tgbotapi.NewMessage(msg.Chat.ID, text)
+	msgConfig.ParseMode = tgbotapi.ModeMarkdownV2
+	msgConfig.DisableWebPagePreview = true
+	b.sendMessage(msgConfig)
+}
+
+// sendEveningDigest previews the evening digest, news shown in it are not recorded as posted
+func sendEveningDigest(b *Bot, msg *tgbotapi.Message) {
+	text := b.eveningDigest(b.loadPostedNews(context.Background(), b.GroupID))
+	msgConfig := tgbotapi.NewMessage(msg.Chat.ID, text)
+	msgConfig.ParseMode = tgbotapi.ModeMarkdownV2
+	msgConfig.DisableWebPagePreview = true
+	b.sendMessage(msgConfig)
+}
+
+func sendWeeklyDigest(b *Bot, msg *tgbotapi.Message) {
+	text := b.weeklyDigest()
 	msgConfig := tgbotapi.NewMessage(msg.Chat.ID, text)
 	msgConfig.ParseMode = tgbotapi.ModeMarkdownV2
 	msgConfig.DisableWebPagePreview = true
@@ -399,50 +378,6 @@ func correctEnglish(b *Bot, msg *tgbotapi.Message) {
 	b.sendMessage(msgConfig)
 }
 
-func translateEng2Ru(b *Bot, msg *tgbotapi.Message) {
-	text := strings.TrimSpace(msg.CommandArguments())
-	if len(text) == 0 {
-		msgConfig := tgbotapi.NewMessage(msg.Chat.ID, "Пустой входной вопрос")
-		msgConfig.ReplyToMessageID = msg.MessageID
-		b.sendMessage(msgConfig)
-		return
-	}
-	ans, err := b.OpenaiAPI.TranslateEnglishToRussian(text)
-	if err != nil || len(ans) == 0 {
-		slog.Error("error occured while call openai", "err", err)
-		msgConfig := tgbotapi.NewMessage(msg.Chat.ID, "Ошибка при вызове ChatGPT :(")
-		msgConfig.ReplyToMessageID = msg.MessageID
-		b.sendMessage(msgConfig)
-		return
-	}
-
-	msgConfig := tgbotapi.NewMessage(msg.Chat.ID, ans)
-	msgConfig.ReplyToMessageID = msg.MessageID
-	b.sendMessage(msgConfig)
-}
-
-func translateRu2Eng(b *Bot, msg *tgbotapi.Message) {
-	text := strings.TrimSpace(msg.CommandArguments())
-	if len(text) == 0 {
-		msgConfig := tgbotapi.NewMessage(msg.Chat.ID, "Пустой входной вопрос")
-		msgConfig.ReplyToMessageID = msg.MessageID
-		b.sendMessage(msgConfig)
-		return
-	}
-	ans, err := b.OpenaiAPI.TranslateRussianToEnglish(text)
-	if err != nil || len(ans) == 0 {
-		slog.Error("error occured while call openai", "err", err)
-		msgConfig := tgbotapi.NewMessage(msg.Chat.ID, "Ошибка при вызове ChatGPT :(")
-		msgConfig.ReplyToMessageID = msg.MessageID
-		b.sendMessage(msgConfig)
-		return
-	}
-
-	msgConfig := tgbotapi.NewMessage(msg.Chat.ID, ans)
-	msgConfig.ReplyToMessageID = msg.MessageID
-	b.sendMessage(msgConfig)
-}
-
 func listCommands(b *Bot, msg *tgbotapi.Message) {
 	var text string
 	for _, cmd := range Commands {
@@ -0,0 +1,236 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/rahfar/familybot/src/apiclient"
+	"github.com/rahfar/familybot/src/db"
+)
+
+const newsPageSize = 5
+
+const newsUsage = "Использование: /news [источник], источник - feed:<id>, category:<id> или адрес сайта, без него показываются все ленты"
+
+// getNews shows unread news entries as a paged list with read, star, translate and summary buttons
+func getNews(b *Bot, msg *tgbotapi.Message) {
+	ctx := context.Background()
+	var source db.NewsSource
+	if arg := strings.TrimSpace(msg.CommandArguments()); arg != "" {
+		var err error
+		source, err = parseNewsSelector(arg)
+		if err != nil {
+			b.replyTo(msg, newsUsage)
+			return
+		}
+	}
+	// Callback data is limited to 64 bytes, so the site URL is replaced with the feed ID
+	if source.SiteURL != "" {
+		feed, err := b.NewsAPI.FindFeed(ctx, source.SiteURL)
+		if err != nil {
+			slog.Info("could not find news feed", "url", source.SiteURL, "err", err)
+			b.replyTo(msg, fmt.Sprintf("Источник %s не найден среди лент", source.SiteURL))
+			return
+		}
+		source = db.NewsSource{FeedID: feed.ID}
+	}
+
+	text, markup, err := b.newsPage(ctx, source, 0)
+	if err != nil {
+		slog.Error("error getting news page", "err", err, "source", source)
+		b.replyTo(msg, "Ошибка при получении новостей")
+		return
+	}
+	msgConfig := tgbotapi.NewMessage(msg.Chat.ID, text)
+	msgConfig.ReplyToMessageID = msg.MessageID
+	msgConfig.ParseMode = tgbotapi.ModeMarkdownV2
+	msgConfig.DisableWebPagePreview = true
+	if markup != nil {
+		msgConfig.ReplyMarkup = *markup
+	}
+	b.sendMessage(msgConfig)
+}
+
+// newsPage renders unread entries of the source from offset, an empty page steps back to the previous one
+func (b *Bot) newsPage(ctx context.Context, source db.NewsSource, offset int) (string, *tgbotapi.InlineKeyboardMarkup, error) {
+	entries, total, err := b.NewsAPI.GetUnreadPage(ctx, source, offset, newsPageSize)
+	for err == nil && len(entries) == 0 && offset > 0 {
+		// Entries of the last page were marked read
+		offset = max(offset-newsPageSize, 0)
+		entries, total, err = b.NewsAPI.GetUnreadPage(ctx, source, offset, newsPageSize)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	if len(entries) == 0 {
+		return "Непрочитанных новостей нет 🎉", nil, nil
+	}
+
+	src := encodeNewsSource(source)
+	text := tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, fmt.Sprintf("📰 Непрочитанные новости %d–%d из %d", offset+1, offset+len(entries), total)) + "\n\n"
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(entries)+1)
+	for i, e := range entries {
+		n := offset + i + 1
+		star := ""
+		if e.Starred {
+			star = "⭐ "
+		}
+		text += fmt.Sprintf(
+			"%d\\. %s[%s](%s)\n",
+			n, star,
+			tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, e.Title),
+			tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, e.URL),
+		)
+		details := e.PublishedAt.Format("02.01 15:04")
+		if e.Feed != nil {
+			details = e.Feed.Title + ", " + details
+		}
+		text += "    _" + tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, details) + "_\n"
+
+		data := func(action string) string {
+			return fmt.Sprintf("news:%s:%s:%d:%d", action, src, offset, e.ID)
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d ✓", n), data("read")),
+			tgbotapi.NewInlineKeyboardButtonData("⭐", data("star")),
+			tgbotapi.NewInlineKeyboardButtonData("🌐", data("translate")),
+			tgbotapi.NewInlineKeyboardButtonData("📝", data("summary")),
+		))
+	}
+
+	nav := make([]tgbotapi.InlineKeyboardButton, 0, 2)
+	if offset > 0 {
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData("◀️", fmt.Sprintf("news:page:%s:%d", src, max(offset-newsPageSize, 0))))
+	}
+	if offset+len(entries) < total {
+		nav = append(nav, tgbotapi.NewInlineKeyboardButtonData("▶️", fmt.Sprintf("news:page:%s:%d", src, offset+newsPageSize)))
+	}
+	if len(nav) > 0 {
+		rows = append(rows, nav)
+	}
+	markup := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return text, &markup, nil
+}
+
+// onNewsCallback handles the buttons of the /news list: news:<action>:<source>:<offset>[:<entry id>]
+func onNewsCallback(b *Bot, query *tgbotapi.CallbackQuery, data string) {
+	parts := strings.Split(data, ":")
+	if len(parts) < 3 {
+		slog.Error("unexpected news callback data", "data", data)
+		return
+	}
+	action := parts[0]
+	source, err1 := decodeNewsSource(parts[1])
+	offset, err2 := strconv.Atoi(parts[2])
+	var entryID int64
+	var err3 error
+	if action != "page" {
+		if len(parts) != 4 {
+			slog.Error("unexpected news callback data", "data", data)
+			return
+		}
+		entryID, err3 = strconv.ParseInt(parts[3], 10, 64)
+	}
+	if err1 != nil || err2 != nil || err3 != nil {
+		slog.Error("unexpected news callback data", "data", data)
+		return
+	}
+
+	ctx := context.Background()
+	chatID := query.Message.Chat.ID
+	switch action {
+	case "page":
+	case "read":
+		if err := b.NewsAPI.SetEntriesStatus(ctx, []int64{entryID}, "read"); err != nil {
+			slog.Error("error marking news entry read", "err", err, "entry_id", entryID)
+			b.replyTo(query.Message, "Ошибка при обновлении новости")
+			return
+		}
+	case "star":
+		if err := b.NewsAPI.ToggleStar(ctx, entryID); err != nil {
+			slog.Error("error starring news entry", "err", err, "entry_id", entryID)
+			b.replyTo(query.Message, "Ошибка при обновлении новости")
+			return
+		}
+	case "translate", "summary":
+		entry, err := b.NewsAPI.GetEntry(ctx, entryID)
+		if err != nil {
+			slog.Error("error getting news entry", "err", err, "entry_id", entryID)
+			b.replyTo(query.Message, "Ошибка при получении новости")
+			return
+		}
+		var text string
+		if action == "translate" {
+			var translation apiclient.Translation
+			translation, err = b.DeeplAPI.TranslateText(ctx, entry.Title, apiclient.TranslateOptions{TargetLang: "RU"})
+			text = translation.Text
+		} else {
+			text, err = b.Summarizer.SummarizeEntry(ctx, *entry)
+		}
+		if err != nil {
+			slog.Error("error processing news entry", "action", action, "err", err, "entry_id", entryID)
+			b.replyTo(query.Message, "Не удалось обработать новость")
+			return
+		}
+		b.replyTo(query.Message, entry.Title+"\n\n"+text)
+		return
+	default:
+		slog.Error("unexpected news callback action", "data", data)
+		return
+	}
+
+	// Read and starred entries change the page, so it is rendered again
+	text, markup, err := b.newsPage(ctx, source, offset)
+	if err != nil {
+		slog.Error("error getting news page", "err", err, "source", source)
+		return
+	}
+	var edit tgbotapi.EditMessageTextConfig
+	if markup != nil {
+		edit = tgbotapi.NewEditMessageTextAndMarkup(chatID, query.Message.MessageID, text, *markup)
+	} else {
+		edit = tgbotapi.NewEditMessageText(chatID, query.Message.MessageID, text)
+	}
+	edit.ParseMode = tgbotapi.ModeMarkdownV2
+	edit.DisableWebPagePreview = true
+	if _, err := b.TGBotAPI.Send(edit); err != nil {
+		slog.Info("could not edit news message", "err", err, "chat_id", chatID)
+	}
+}
+
+// encodeNewsSource packs the source into callback data: a for all feeds, f<id> for a feed, c<id> for a category
+func encodeNewsSource(source db.NewsSource) string {
+	switch {
+	case source.FeedID > 0:
+		return fmt.Sprintf("f%d", source.FeedID)
+	case source.CategoryID > 0:
+		return fmt.Sprintf("c%d", source.CategoryID)
+	default:
+		return "a"
+	}
+}
+
+func decodeNewsSource(s string) (db.NewsSource, error) {
+	if s == "a" {
+		return db.NewsSource{}, nil
+	}
+	if len(s) < 2 {
+		return db.NewsSource{}, fmt.Errorf("invalid news source %q", s)
+	}
+	id, err := strconv.ParseInt(s[1:], 10, 64)
+	if err != nil {
+		return db.NewsSource{}, err
+	}
+	switch s[0] {
+	case 'f':
+		return db.NewsSource{FeedID: id}, nil
+	case 'c':
+		return db.NewsSource{CategoryID: id}, nil
+	}
+	return db.NewsSource{}, fmt.Errorf("invalid news source %q", s)
+}
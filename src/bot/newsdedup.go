@@ -0,0 +1,147 @@
+package bot
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rahfar/familybot/src/apiclient"
+)
+
+const (
+	// newsDedupFetchFactor is how many more entries than shown are fetched per source,
+	// so sources still fill their count when the newest entries were already posted
+	newsDedupFetchFactor = 3
+	// minTitleWordSize drops short words like prepositions and articles from fuzzy title matching
+	minTitleWordSize = 4
+	// titleStemSize cuts words to their beginning, so different forms of a word like "Путин" and "Путиным" match
+	titleStemSize = 5
+	// fuzzyTitleSimilarity is the share of common significant words above which titles are the same story
+	fuzzyTitleSimilarity = 0.5
+	minCommonTitleWords  = 3
+)
+
+// postedNews is the record of news posted to a chat, the digest skips entries with a posted ID or title.
+// With fuzzy matching titles that share most significant words are the same story, e.g. from different feeds
+type postedNews struct {
+	// provider is the name of the news provider, entry IDs of miniflux and rss overlap
+	provider string
+	ids      map[int64]bool
+	titles   map[string]bool
+	words    [][]string
+	fuzzy    bool
+	added    []string
+}
+
+// loadPostedNews reads the record of the chat, the digest is not deduplicated if it cannot be read
+func (b *Bot) loadPostedNews(ctx context.Context, chatID int64) *postedNews {
+	p := &postedNews{provider: b.NewsAPI.Name(), ids: make(map[int64]bool), titles: make(map[string]bool)}
+	fuzzy, err := b.DBClient.IsFuzzyNewsDedupEnabled(ctx, chatID)
+	if err != nil {
+		slog.Error("error getting news dedup settings", "err", err, "chat_id", chatID)
+	}
+	p.fuzzy = fuzzy
+
+	keys, err := b.DBClient.GetPostedNews(ctx, chatID)
+	if err != nil {
+		slog.Error("error getting posted news", "err", err, "chat_id", chatID)
+		return p
+	}
+	for _, k := range keys {
+		kind, value, _ := strings.Cut(k, ":")
+		switch kind {
+		case "id":
+			// IDs are stored as "id:<provider>:<id>", IDs of another provider are not the same entries
+			provider, idStr, _ := strings.Cut(value, ":")
+			if provider != p.provider {
+				continue
+			}
+			if id, err := strconv.ParseInt(idStr, 10, 64); err == nil {
+				p.ids[id] = true
+			}
+		case "title":
+			p.titles[value] = true
+		case "words":
+			p.words = append(p.words, strings.Fields(value))
+		}
+	}
+	return p
+}
+
+// postedEntry checks if the entry itself was posted, before its title is translated
+func (p *postedNews) postedEntry(e apiclient.NewsEntry) bool {
+	return p.ids[e.ID]
+}
+
+// postedTitle checks if a story with the title was posted, the title is the one shown in the digest
+func (p *postedNews) postedTitle(title string) bool {
+	if p.titles[titleHash(title)] {
+		return true
+	}
+	if !p.fuzzy {
+		return false
+	}
+	words := titleWords(title)
+	return slices.ContainsFunc(p.words, func(posted []string) bool { return similarTitles(words, posted) })
+}
+
+// add records the posted entry with its shown title
+func (p *postedNews) add(e apiclient.NewsEntry, title string) {
+	hash, words := titleHash(title), titleWords(title)
+	p.ids[e.ID] = true
+	p.titles[hash] = true
+	p.words = append(p.words, words)
+	p.added = append(p.added, "id:"+p.provider+":"+strconv.FormatInt(e.ID, 10), "title:"+hash)
+	if len(words) > 0 {
+		p.added = append(p.added, "words:"+strings.Join(words, " "))
+	}
+}
+
+// savePostedNews stores entries added to the record since it was loaded
+func (b *Bot) savePostedNews(ctx context.Context, chatID int64, p *postedNews) {
+	if err := b.DBClient.AddPostedNews(ctx, chatID, p.added); err != nil {
+		slog.Error("error saving posted news", "err", err, "chat_id", chatID)
+	}
+}
+
+// normalizeTitle lowercases the title and keeps only letters and digits separated by single spaces
+func normalizeTitle(title string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+func titleHash(title string) string {
+	sum := md5.Sum([]byte(normalizeTitle(title)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// titleWords returns sorted unique stems of significant words of the title
+func titleWords(title string) []string {
+	words := make([]string, 0)
+	for _, w := range strings.Fields(normalizeTitle(title)) {
+		if utf8.RuneCountInString(w) >= minTitleWordSize {
+			words = append(words, string([]rune(w)[:min(utf8.RuneCountInString(w), titleStemSize)]))
+		}
+	}
+	slices.Sort(words)
+	return slices.Compact(words)
+}
+
+// similarTitles compares sorted word sets of two titles by the Jaccard index
+func similarTitles(a, b []string) bool {
+	common := 0
+	for _, w := range a {
+		if _, found := slices.BinarySearch(b, w); found {
+			common++
+		}
+	}
+	total := len(a) + len(b) - common
+	return common >= minCommonTitleWords && float64(common)/float64(total) >= fuzzyTitleSimilarity
+}
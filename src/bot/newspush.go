@@ -0,0 +1,274 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/rahfar/familybot/src/apiclient"
+	"github.com/rahfar/familybot/src/db"
+	"github.com/rahfar/familybot/src/metrics"
+)
+
+const (
+	newsPushInterval = 5 * time.Minute
+	// newsPushBatch limits entries pushed per subscription at once, the rest go out on the next poll
+	newsPushBatch = 10
+)
+
+const subscribeUsage = "Использование:\n" +
+	"/subscribe - подписки чата\n" +
+	"/subscribe <источник> [lang:<язык>] [слова...] - присылать новые записи ленты, например\n" +
+	"  /subscribe feed:12\n" +
+	"  /subscribe category:3 lang:RU flood storm -sport\n" +
+	"  источник - feed:<id>, category:<id> или адрес сайта, слова - запись должна содержать одно из них, -слово исключает запись\n" +
+	"/unsubscribe <номер> - отменить подписку"
+
+func (b *Bot) newsPushJob() {
+	slog.Info("starting news push job")
+	for {
+		b.checkNewsSubscriptions()
+		time.Sleep(newsPushInterval)
+	}
+}
+
+// checkNewsSubscriptions pushes entries that appeared in the feeds since the last poll
+func (b *Bot) checkNewsSubscriptions() {
+	ctx := context.Background()
+	chatIDs, err := b.DBClient.GetNewsSubscriptionChats(ctx)
+	if err != nil {
+		slog.Error("error getting news subscription chats", "err", err)
+		return
+	}
+
+	for _, chatID := range chatIDs {
+		subscriptions, err := b.DBClient.GetNewsSubscriptions(ctx, chatID)
+		if err != nil {
+			slog.Error("error getting news subscriptions", "err", err, "chat_id", chatID)
+			continue
+		}
+		for _, s := range subscriptions {
+			b.pushNewsSubscription(ctx, chatID, s)
+		}
+	}
+}
+
+func (b *Bot) pushNewsSubscription(ctx context.Context, chatID int64, s db.NewsSubscription) {
+	lastSeen, err := b.DBClient.GetNewsLastSeen(ctx, chatID, s.ID)
+	if err != nil {
+		slog.Error("error getting last seen news entry", "err", err, "chat_id", chatID, "subscription", s.ID)
+		return
+	}
+	source := db.NewsSource{FeedID: s.FeedID, CategoryID: s.CategoryID}
+	entries, err := b.NewsAPI.GetEntriesAfter(ctx, source, lastSeen, newsPushBatch)
+	if err != nil {
+		slog.Error("error calling news api", "err", err, "chat_id", chatID, "subscription", s.ID)
+		return
+	}
+	if len(entries) == 0 {
+		return
+	}
+
+	matched := make([]apiclient.NewsEntry, 0, len(entries))
+	for _, e := range entries {
+		if matchesKeywords(e, s.Keywords) {
+			matched = append(matched, e)
+		}
+	}
+	if len(matched) > 0 {
+		msg := tgbotapi.NewMessage(chatID, b.formatNewsPush(ctx, s, matched))
+		msg.ParseMode = tgbotapi.ModeMarkdownV2
+		// A single entry gets a link preview, a list would only preview the first link
+		msg.DisableWebPagePreview = len(matched) > 1
+		b.sendMessage(msg)
+		metrics.NewsPushCounter.Add(float64(len(matched)))
+	}
+
+	// Filtered out entries are skipped as well, so they are not checked again
+	if err := b.DBClient.SetNewsLastSeen(ctx, chatID, s.ID, entries[len(entries)-1].ID); err != nil {
+		slog.Error("error saving last seen news entry", "err", err, "chat_id", chatID, "subscription", s.ID)
+	}
+}
+
+func (b *Bot) formatNewsPush(ctx context.Context, s db.NewsSubscription, entries []apiclient.NewsEntry) string {
+	titles := b.translateTitles(ctx, entries, s.Translate)
+	text := "🔔 *" + tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, s.Label) + "*\n"
+	for i, e := range entries {
+		text += fmt.Sprintf(
+			"• [%s](%s)\n",
+			tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, titles[i]),
+			tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, e.URL),
+		)
+	}
+	return text
+}
+
+// matchesKeywords checks that the entry mentions one of the keywords and none of the -keywords,
+// an entry matches if there are no keywords to look for
+func matchesKeywords(e apiclient.NewsEntry, keywords []string) bool {
+	if len(keywords) == 0 {
+		return true
+	}
+	text := strings.ToLower(e.Title + " " + apiclient.HTMLToText(e.Content))
+	included, hasIncluded := false, false
+	for _, k := range keywords {
+		if exclude, ok := strings.CutPrefix(k, "-"); ok {
+			if strings.Contains(text, exclude) {
+				return false
+			}
+			continue
+		}
+		hasIncluded = true
+		included = included || strings.Contains(text, k)
+	}
+	return included || !hasIncluded
+}
+
+// subscribeNews lists subscriptions of the chat or subscribes it to new entries of a feed or category
+func subscribeNews(b *Bot, msg *tgbotapi.Message) {
+	ctx := context.Background()
+	chatID := msg.Chat.ID
+	subscriptions, err := b.DBClient.GetNewsSubscriptions(ctx, chatID)
+	if err != nil {
+		slog.Error("error getting news subscriptions", "err", err, "chat_id", chatID)
+		b.replyTo(msg, "Ошибка при получении подписок")
+		return
+	}
+
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) == 0 {
+		b.replyTo(msg, formatNewsSubscriptions(subscriptions))
+		return
+	}
+
+	subscription, err := b.parseNewsSubscription(ctx, args)
+	if err != nil {
+		b.replyTo(msg, err.Error())
+		return
+	}
+	for _, s := range subscriptions {
+		subscription.ID = max(subscription.ID, s.ID)
+	}
+	subscription.ID++
+
+	// Only entries that appear after the subscription are pushed
+	lastID, err := b.NewsAPI.GetLastEntryID(ctx, db.NewsSource{FeedID: subscription.FeedID, CategoryID: subscription.CategoryID})
+	if err == nil {
+		err = b.DBClient.SetNewsLastSeen(ctx, chatID, subscription.ID, lastID)
+	}
+	if err == nil {
+		err = b.DBClient.SetNewsSubscriptions(ctx, chatID, append(subscriptions, subscription))
+	}
+	if err != nil {
+		slog.Error("error saving news subscription", "err", err, "chat_id", chatID)
+		b.replyTo(msg, "Ошибка при сохранении подписки")
+		return
+	}
+	b.replyTo(msg, fmt.Sprintf("Подписка %d на «%s» добавлена, новые записи будут приходить в течение %d минут", subscription.ID, subscription.Label, int(newsPushInterval.Minutes())))
+}
+
+// parseNewsSubscription parses "<feed:ID|category:ID|url> [lang:XX] [keywords...]" and resolves the label with the news provider
+func (b *Bot) parseNewsSubscription(ctx context.Context, args []string) (db.NewsSubscription, error) {
+	var subscription db.NewsSubscription
+	source, err := parseNewsSelector(args[0])
+	if err != nil {
+		return subscription, fmt.Errorf("%s", subscribeUsage)
+	}
+	for _, arg := range args[1:] {
+		if lang, ok := strings.CutPrefix(arg, "lang:"); ok {
+			lang = strings.ToUpper(lang)
+			if !targetLangRe.MatchString(lang) {
+				return subscription, fmt.Errorf("неверный язык, пример: lang:RU или lang:EN-GB")
+			}
+			subscription.Translate = lang
+			continue
+		}
+		subscription.Keywords = append(subscription.Keywords, strings.ToLower(arg))
+	}
+
+	if source.SiteURL != "" {
+		feed, err := b.NewsAPI.FindFeed(ctx, source.SiteURL)
+		if err != nil {
+			slog.Info("could not find news feed", "url", source.SiteURL, "err", err)
+			return subscription, fmt.Errorf("источник %s не найден среди лент", source.SiteURL)
+		}
+		subscription.FeedID, subscription.Label = feed.ID, feed.Title
+		return subscription, nil
+	}
+
+	feeds, err := b.NewsAPI.Feeds(ctx)
+	if err != nil {
+		slog.Error("error getting news feeds", "err", err)
+		return subscription, fmt.Errorf("ошибка при получении лент")
+	}
+	subscription.FeedID, subscription.CategoryID = source.FeedID, source.CategoryID
+	for _, f := range feeds {
+		switch {
+		case source.FeedID > 0 && f.ID == source.FeedID:
+			subscription.Label = f.Title
+		case source.CategoryID > 0 && f.Category != nil && f.Category.ID == source.CategoryID:
+			subscription.Label = f.Category.Title
+		}
+	}
+	if subscription.Label == "" {
+		return subscription, fmt.Errorf("источник %s не найден среди лент, список лент - /feeds", args[0])
+	}
+	return subscription, nil
+}
+
+// unsubscribeNews removes a news subscription of the chat: /unsubscribe <n>
+func unsubscribeNews(b *Bot, msg *tgbotapi.Message) {
+	ctx := context.Background()
+	chatID := msg.Chat.ID
+	subscriptions, err := b.DBClient.GetNewsSubscriptions(ctx, chatID)
+	if err != nil {
+		slog.Error("error getting news subscriptions", "err", err, "chat_id", chatID)
+		b.replyTo(msg, "Ошибка при получении подписок")
+		return
+	}
+
+	arg := strings.TrimSpace(msg.CommandArguments())
+	if arg == "" {
+		b.replyTo(msg, formatNewsSubscriptions(subscriptions))
+		return
+	}
+	id, parseErr := strconv.Atoi(arg)
+	i := slices.IndexFunc(subscriptions, func(s db.NewsSubscription) bool { return s.ID == id })
+	if parseErr != nil || i < 0 {
+		b.replyTo(msg, fmt.Sprintf("Подписка %s не найдена", arg))
+		return
+	}
+	if err := b.DBClient.SetNewsSubscriptions(ctx, chatID, slices.Delete(subscriptions, i, i+1)); err != nil {
+		slog.Error("error saving news subscriptions", "err", err, "chat_id", chatID)
+		b.replyTo(msg, "Ошибка при сохранении подписок")
+		return
+	}
+	if err := b.DBClient.DeleteNewsLastSeen(ctx, chatID, id); err != nil {
+		slog.Warn("could not delete last seen news entry", "err", err, "chat_id", chatID, "subscription", id)
+	}
+	b.replyTo(msg, "Подписка отменена")
+}
+
+func formatNewsSubscriptions(subscriptions []db.NewsSubscription) string {
+	if len(subscriptions) == 0 {
+		return "Подписок нет\n\n" + subscribeUsage
+	}
+	text := "Подписки на новости:\n"
+	for _, s := range subscriptions {
+		text += fmt.Sprintf("%d. %s (%s)", s.ID, s.Label, formatNewsSelector(db.NewsSource{FeedID: s.FeedID, CategoryID: s.CategoryID}))
+		if s.Translate != "" {
+			text += ", перевод на " + s.Translate
+		}
+		if len(s.Keywords) > 0 {
+			text += ", слова: " + strings.Join(s.Keywords, " ")
+		}
+		text += "\n"
+	}
+	return text
+}
@@ -0,0 +1,244 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/rahfar/familybot/src/apiclient"
+	"github.com/rahfar/familybot/src/db"
+)
+
+const maxNewsSourceCount = 10
+
+const newsSourcesUsage = "Использование:\n" +
+	"/newssources - источники новостей дайджеста\n" +
+	"/newssources add <источник> <количество> <язык|-> <название> - добавить источник, например\n" +
+	"  /newssources add https://www.bbc.com 2 RU BBC\n" +
+	"  /newssources add feed:12 3 - Медуза\n" +
+	"  /newssources add category:4 5 - Наука\n" +
+	"/newssources summary <номер> on|off - краткий пересказ под каждым заголовком\n" +
+	"/newssources remove <номер> - удалить источник\n" +
+	"/newssources fuzzy on|off - объединять похожие заголовки из разных лент\n" +
+	"/newssources reset - вернуть источники по умолчанию"
+
+// targetLangRe matches DeepL target languages like RU, EN-GB or PT-BR
+var targetLangRe = regexp.MustCompile(`^[A-Z]{2}(-[A-Z]{2,4})?$`)
+
+// manageNewsSources shows and changes the news sources of the chat's digest
+func manageNewsSources(b *Bot, msg *tgbotapi.Message) {
+	ctx := context.Background()
+	chatID := msg.Chat.ID
+	sources, err := b.DBClient.GetNewsSources(ctx, chatID)
+	if err != nil {
+		slog.Error("error getting news sources", "err", err, "chat_id", chatID)
+		b.replyTo(msg, "Ошибка при получении источников новостей")
+		return
+	}
+
+	args := strings.Fields(msg.CommandArguments())
+	switch {
+	case len(args) == 0:
+		text := formatNewsSources(sources)
+		if fuzzy, err := b.DBClient.IsFuzzyNewsDedupEnabled(ctx, chatID); err != nil {
+			slog.Error("error getting news dedup settings", "err", err, "chat_id", chatID)
+		} else if fuzzy {
+			text += "\nПохожие заголовки из разных лент объединяются"
+		}
+		b.replyTo(msg, text)
+		return
+	case args[0] == "fuzzy" && len(args) == 2 && (args[1] == "on" || args[1] == "off"):
+		err = b.DBClient.SetFuzzyNewsDedup(ctx, chatID, args[1] == "on")
+		if err == nil {
+			if args[1] == "on" {
+				b.replyTo(msg, "Похожие заголовки из разных лент будут объединяться")
+			} else {
+				b.replyTo(msg, "Похожие заголовки больше не объединяются, повторяются только одинаковые")
+			}
+			return
+		}
+	case args[0] == "reset" && len(args) == 1:
+		err = b.DBClient.ResetNewsSources(ctx, chatID)
+		if err == nil {
+			b.replyTo(msg, formatNewsSources(db.DefaultNewsSources))
+			return
+		}
+	case args[0] == "add" && len(args) >= 5:
+		source, parseErr := parseNewsSource(args[1:])
+		if parseErr != nil {
+			b.replyTo(msg, parseErr.Error())
+			return
+		}
+		// The source must resolve to a feed, otherwise it would silently never show up
+		probe := source
+		probe.Count = 1
+		if _, fetchErr := b.NewsAPI.GetLatestNews(ctx, probe); fetchErr != nil {
+			slog.Info("could not fetch news source", "source", args[1], "err", fetchErr)
+			b.replyTo(msg, fmt.Sprintf("Источник %s не найден среди лент", args[1]))
+			return
+		}
+		sources = append(sources, source)
+		err = b.DBClient.SetNewsSources(ctx, chatID, sources)
+		if err == nil {
+			b.replyTo(msg, formatNewsSources(sources))
+			return
+		}
+	case args[0] == "summary" && len(args) == 3 && (args[2] == "on" || args[2] == "off"):
+		n, parseErr := strconv.Atoi(args[1])
+		if parseErr != nil || n < 1 || n > len(sources) {
+			b.replyTo(msg, fmt.Sprintf("Источник %s не найден", args[1]))
+			return
+		}
+		sources[n-1].Summarize = args[2] == "on"
+		err = b.DBClient.SetNewsSources(ctx, chatID, sources)
+		if err == nil {
+			b.replyTo(msg, formatNewsSources(sources))
+			return
+		}
+	case args[0] == "remove" && len(args) == 2:
+		n, parseErr := strconv.Atoi(args[1])
+		if parseErr != nil || n < 1 || n > len(sources) {
+			b.replyTo(msg, fmt.Sprintf("Источник %s не найден", args[1]))
+			return
+		}
+		sources = slices.Delete(sources, n-1, n)
+		err = b.DBClient.SetNewsSources(ctx, chatID, sources)
+		if err == nil {
+			b.replyTo(msg, formatNewsSources(sources))
+			return
+		}
+	default:
+		b.replyTo(msg, newsSourcesUsage)
+		return
+	}
+
+	slog.Error("error saving news sources", "err", err, "chat_id", chatID)
+	b.replyTo(msg, "Ошибка при сохранении источников новостей")
+}
+
+// parseNewsSource parses "<feed:ID|category:ID|url> <count> <lang|-> <label...>"
+func parseNewsSource(args []string) (db.NewsSource, error) {
+	source, err := parseNewsSelector(args[0])
+	if err != nil {
+		return source, err
+	}
+
+	count, err := strconv.Atoi(args[1])
+	if err != nil || count < 1 || count > maxNewsSourceCount {
+		return source, fmt.Errorf("неверное количество, от 1 до %d", maxNewsSourceCount)
+	}
+	source.Count = count
+
+	if lang := strings.ToUpper(args[2]); lang != "-" {
+		if !targetLangRe.MatchString(lang) {
+			return source, fmt.Errorf("неверный язык, пример: RU, EN-GB или - без перевода")
+		}
+		source.Translate = lang
+	}
+	source.Label = strings.Join(args[3:], " ")
+	return source, nil
+}
+
+// parseNewsSelector parses "feed:ID", "category:ID" or a site URL into a news source without count and label
+func parseNewsSelector(selector string) (db.NewsSource, error) {
+	var source db.NewsSource
+	switch {
+	case strings.HasPrefix(selector, "feed:"):
+		id, err := strconv.ParseInt(strings.TrimPrefix(selector, "feed:"), 10, 64)
+		if err != nil || id <= 0 {
+			return source, fmt.Errorf("неверный ID ленты")
+		}
+		source.FeedID = id
+	case strings.HasPrefix(selector, "category:"):
+		id, err := strconv.ParseInt(strings.TrimPrefix(selector, "category:"), 10, 64)
+		if err != nil || id <= 0 {
+			return source, fmt.Errorf("неверный ID категории")
+		}
+		source.CategoryID = id
+	case strings.HasPrefix(selector, "http://") || strings.HasPrefix(selector, "https://"):
+		source.SiteURL = strings.TrimSuffix(selector, "/")
+	default:
+		return source, fmt.Errorf("%s", newsSourcesUsage)
+	}
+	return source, nil
+}
+
+func formatNewsSources(sources []db.NewsSource) string {
+	if len(sources) == 0 {
+		return "Источников новостей нет\n\n" + newsSourcesUsage
+	}
+	text := "Источники новостей дайджеста:\n"
+	for i, s := range sources {
+		text += fmt.Sprintf("%d. %s (%s), %d шт.", i+1, s.Label, formatNewsSelector(s), s.Count)
+		if s.Translate != "" {
+			text += ", перевод на " + s.Translate
+		}
+		if s.Summarize {
+			text += ", с пересказом"
+		}
+		text += "\n"
+	}
+	return text
+}
+
+func formatNewsSelector(s db.NewsSource) string {
+	switch {
+	case s.FeedID > 0:
+		return fmt.Sprintf("лента %d", s.FeedID)
+	case s.CategoryID > 0:
+		return fmt.Sprintf("категория %d", s.CategoryID)
+	default:
+		return s.SiteURL
+	}
+}
+
+// listFeeds shows news feeds grouped by category to configure news sources (admin only): /feeds [refresh]
+func listFeeds(b *Bot, msg *tgbotapi.Message) {
+	if !b.isUserAdmin(msg.From.ID) {
+		b.replyTo(msg, "У вас нет прав для выполнения этой команды")
+		return
+	}
+
+	if strings.TrimSpace(msg.CommandArguments()) == "refresh" {
+		b.NewsAPI.InvalidateFeeds()
+	}
+	feeds, err := b.NewsAPI.Feeds(context.Background())
+	if err != nil {
+		slog.Error("error getting news feeds", "err", err)
+		b.replyTo(msg, "Ошибка при получении лент")
+		return
+	}
+	if len(feeds) == 0 {
+		b.replyTo(msg, "Лент нет")
+		return
+	}
+
+	byCategory := make(map[int64][]apiclient.NewsFeed)
+	categories := make([]apiclient.NewsCategory, 0)
+	for _, f := range feeds {
+		category := apiclient.NewsCategory{Title: "Без категории"}
+		if f.Category != nil {
+			category = *f.Category
+		}
+		if _, ok := byCategory[category.ID]; !ok {
+			categories = append(categories, category)
+		}
+		byCategory[category.ID] = append(byCategory[category.ID], f)
+	}
+	slices.SortFunc(categories, func(a, b apiclient.NewsCategory) int { return strings.Compare(a.Title, b.Title) })
+
+	text := "Ленты новостей, источник добавляется командой /newssources add feed:<id> или category:<id>\n"
+	for _, c := range categories {
+		text += fmt.Sprintf("\ncategory:%d %s\n", c.ID, c.Title)
+		for _, f := range byCategory[c.ID] {
+			text += fmt.Sprintf("  feed:%d %s — %s\n", f.ID, f.Title, f.SiteURL)
+		}
+	}
+	b.replyTo(msg, text)
+}
@@ -0,0 +1,178 @@
+package bot
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/rahfar/familybot/src/apiclient"
+	"github.com/rahfar/familybot/src/chart"
+)
+
+const (
+	rateChartName      = "rates.png"
+	defaultChartPeriod = 30
+	maxChartPeriod     = 730
+	maxBackfillPeriod  = 365
+)
+
+const chartUsage = "Использование: /chart <пара> [период], например /chart USD/RUB 90d, период в днях (d), неделях (w), месяцах (m) или годах (y)"
+
+// getRateChart renders the history of a currency pair: /chart USD/RUB 90d
+func getRateChart(b *Bot, msg *tgbotapi.Message) {
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) == 0 || len(args) > 2 {
+		b.replyTo(msg, chartUsage)
+		return
+	}
+	pair, err := apiclient.ParseCurrencyPair(args[0])
+	if err != nil {
+		b.replyTo(msg, chartUsage)
+		return
+	}
+	days := defaultChartPeriod
+	if len(args) == 2 {
+		days, err = parsePeriod(args[1])
+		if err != nil || days < 2 || days > maxChartPeriod {
+			b.replyTo(msg, fmt.Sprintf("Неверный период, от 2 до %d дней", maxChartPeriod))
+			return
+		}
+	}
+
+	now := time.Now().UTC()
+	points, source, err := b.ExchangeAPI.GetHistory(pair, now.AddDate(0, 0, -days), now)
+	if err != nil {
+		slog.Error("could not get currency history", "pair", pair, "err", err)
+		b.replyTo(msg, "Ошибка при получении истории курсов")
+		return
+	}
+	// The latest rate completes the history of past days
+	if quote, err := b.ExchangeAPI.PairRate(pair, now); err == nil && quote.Source == source {
+		points = append(points, apiclient.HistoryPoint{Date: now, Rate: quote.Rate})
+	}
+	if len(points) < 2 {
+		b.replyTo(msg, fmt.Sprintf("Недостаточно истории для %s, администратор может загрузить ее командой /backfill", pair))
+		return
+	}
+
+	line := chart.Series{Name: pair.String(), Color: chart.Palette[1]}
+	low, high := points[0], points[0]
+	for _, p := range points {
+		line.Points = append(line.Points, chart.Point{X: p.Date, Y: p.Rate})
+		if p.Rate < low.Rate {
+			low = p
+		}
+		if p.Rate > high.Rate {
+			high = p
+		}
+	}
+	c := chart.Chart{
+		Lines:   []chart.Series{line},
+		Labels:  make(map[time.Time]string),
+		YFormat: rateChartFormat(high.Rate - low.Rate),
+	}
+	// Label every week on short periods and every month on long ones
+	first := points[0].Date
+	if days <= 60 {
+		for d := first; d.Before(now); d = d.AddDate(0, 0, 7) {
+			c.Labels[d] = d.Format("02.01")
+		}
+	} else {
+		for d := time.Date(first.Year(), first.Month()+1, 1, 0, 0, 0, 0, time.UTC); d.Before(now); d = d.AddDate(0, 1, 0) {
+			c.Separators = append(c.Separators, d)
+			c.Labels[d] = d.Format("01.06")
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := c.Render(&buf); err != nil {
+		slog.Error("could not render rate chart", "err", err)
+		b.replyTo(msg, "Ошибка при построении графика")
+		return
+	}
+
+	last := points[len(points)-1]
+	photo := tgbotapi.NewPhoto(msg.Chat.ID, tgbotapi.FileBytes{Name: rateChartName, Bytes: buf.Bytes()})
+	photo.ReplyToMessageID = msg.MessageID
+	photo.Caption = fmt.Sprintf(
+		"%s с %s: %s (%+.2f%%)\nмин %s (%s), макс %s (%s)\nИсточник: %s",
+		pair, first.Format("02.01.2006"),
+		formatPrice(last.Rate, pair.Quote), (last.Rate/points[0].Rate-1)*100,
+		formatPrice(low.Rate, pair.Quote), low.Date.Format("02.01"),
+		formatPrice(high.Rate, pair.Quote), high.Date.Format("02.01"),
+		rateSourceName(source),
+	)
+	b.sendPhoto(photo)
+}
+
+// backfillRates loads missing days of the rate history (admin only): /backfill [days]
+func backfillRates(b *Bot, msg *tgbotapi.Message) {
+	if !b.isUserAdmin(msg.From.ID) {
+		b.replyTo(msg, "У вас нет прав для выполнения этой команды")
+		return
+	}
+
+	days := defaultChartPeriod
+	if arg := strings.TrimSpace(msg.CommandArguments()); arg != "" {
+		var err error
+		days, err = parsePeriod(arg)
+		if err != nil || days < 1 || days > maxBackfillPeriod {
+			b.replyTo(msg, fmt.Sprintf("Неверный период, от 1 до %d дней", maxBackfillPeriod))
+			return
+		}
+	}
+
+	// Every missing day is a request to each provider, so the result is sent when the backfill finishes
+	b.replyTo(msg, fmt.Sprintf("Загрузка истории за %d дней начата", days))
+	go func() {
+		now := time.Now().UTC()
+		fetched, err := b.ExchangeAPI.Backfill(now.AddDate(0, 0, -days), now)
+		if err != nil {
+			slog.Error("could not backfill currency history", "fetched", fetched, "err", err)
+			b.replyTo(msg, fmt.Sprintf("Загружено дней: %d, ошибка: %s", fetched, err))
+			return
+		}
+		b.replyTo(msg, fmt.Sprintf("Загружено дней: %d", fetched))
+	}()
+}
+
+// parsePeriod parses periods like 90d, 12w, 6m or 1y into days, a plain number means days
+func parsePeriod(s string) (int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	multiplier := 1
+	switch {
+	case strings.HasSuffix(s, "d"):
+		s = strings.TrimSuffix(s, "d")
+	case strings.HasSuffix(s, "w"):
+		s, multiplier = strings.TrimSuffix(s, "w"), 7
+	case strings.HasSuffix(s, "m"):
+		s, multiplier = strings.TrimSuffix(s, "m"), 30
+	case strings.HasSuffix(s, "y"):
+		s, multiplier = strings.TrimSuffix(s, "y"), 365
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	return n * multiplier, nil
+}
+
+// rateChartFormat picks the precision of axis ticks for the range of rates
+func rateChartFormat(span float64) string {
+	switch {
+	case span >= 50:
+		return "%.0f"
+	case span >= 0.5:
+		return "%.1f"
+	case span > 0:
+		return fmt.Sprintf("%%.%df", min(int(math.Ceil(-math.Log10(span)))+2, 6))
+	default:
+		return "%.2f"
+	}
+}
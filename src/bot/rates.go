@@ -0,0 +1,209 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/rahfar/familybot/src/apiclient"
+)
+
+const ratesUsage = "Использование:\n" +
+	"/rates - курсы валютных пар чата\n" +
+	"/rates add <пара> - добавить пару, например EUR/RUB\n" +
+	"/rates remove <пара> - удалить пару\n" +
+	"/rates reset - вернуть пары по умолчанию"
+
+// rateSources are names of exchange rates providers shown next to the values
+var rateSources = map[string]string{
+	"currencyapi": "currencyapi.com",
+	"cbr":         "ЦБ РФ",
+	"ecb":         "ЕЦБ",
+}
+
+func rateSourceName(provider string) string {
+	if name, ok := rateSources[provider]; ok {
+		return name
+	}
+	return provider
+}
+
+// currencySymbols are shown after the rate instead of the quote currency code
+var currencySymbols = map[string]string{
+	"RUB": "₽",
+	"USD": "$",
+	"EUR": "€",
+}
+
+// manageRates shows exchange rates of the chat's currency pairs and changes the list of pairs
+func manageRates(b *Bot, msg *tgbotapi.Message) {
+	ctx := context.Background()
+	chatID := msg.Chat.ID
+	args := strings.Fields(msg.CommandArguments())
+	if len(args) == 0 {
+		text := b.formatRates(chatID, rateDeltaPeriods)
+		if text == "" {
+			b.replyTo(msg, "Нет данных")
+			return
+		}
+		msgConfig := tgbotapi.NewMessage(chatID, "_Курсы валют:_\n"+text)
+		msgConfig.ReplyToMessageID = msg.MessageID
+		msgConfig.ParseMode = tgbotapi.ModeMarkdownV2
+		b.sendMessage(msgConfig)
+		return
+	}
+
+	pairs, err := b.DBClient.GetCurrencyPairs(ctx, chatID)
+	if err != nil {
+		slog.Error("error getting currency pairs", "err", err, "chat_id", chatID)
+		b.replyTo(msg, "Ошибка при получении валютных пар")
+		return
+	}
+
+	switch {
+	case args[0] == "reset" && len(args) == 1:
+		err = b.DBClient.ResetCurrencyPairs(ctx, chatID)
+	case args[0] == "add" && len(args) == 2:
+		pair, parseErr := apiclient.ParseCurrencyPair(args[1])
+		if parseErr != nil {
+			b.replyTo(msg, "Неверная пара, пример: EUR/RUB")
+			return
+		}
+		if slices.Contains(pairs, pair.String()) {
+			b.replyTo(msg, fmt.Sprintf("Пара %s уже есть", pair))
+			return
+		}
+		if _, rateErr := b.ExchangeAPI.PairRate(pair, time.Now().UTC()); rateErr != nil {
+			slog.Info("could not get currency pair rate", "pair", pair, "err", rateErr)
+			b.replyTo(msg, fmt.Sprintf("Нет курса для пары %s", pair))
+			return
+		}
+		err = b.DBClient.SetCurrencyPairs(ctx, chatID, append(pairs, pair.String()))
+	case args[0] == "remove" && len(args) == 2:
+		pair, parseErr := apiclient.ParseCurrencyPair(args[1])
+		i := slices.Index(pairs, pair.String())
+		if parseErr != nil || i < 0 {
+			b.replyTo(msg, fmt.Sprintf("Пара %s не найдена", args[1]))
+			return
+		}
+		err = b.DBClient.SetCurrencyPairs(ctx, chatID, slices.Delete(pairs, i, i+1))
+	default:
+		b.replyTo(msg, ratesUsage)
+		return
+	}
+
+	if err != nil {
+		slog.Error("error saving currency pairs", "err", err, "chat_id", chatID)
+		b.replyTo(msg, "Ошибка при сохранении валютных пар")
+		return
+	}
+	b.replyTo(msg, "Валютные пары сохранены")
+}
+
+// ratePeriod is a period the current rate is compared with
+type ratePeriod struct {
+	Name string
+	Ago  func(time.Time) time.Time
+}
+
+// rateDeltaPeriods are periods the current rates are compared with
+var rateDeltaPeriods = []ratePeriod{
+	{"день", func(t time.Time) time.Time { return t.AddDate(0, 0, -1) }},
+	{"неделя", func(t time.Time) time.Time { return t.AddDate(0, 0, -7) }},
+	{"месяц", func(t time.Time) time.Time { return t.AddDate(0, -1, 0) }},
+}
+
+// formatRates renders rates of the chat's currency pairs with changes over the given periods,
+// an empty string is returned if rates are not available
+func (b *Bot) formatRates(chatID int64, periods []ratePeriod) string {
+	now := time.Now().UTC()
+	dates := []time.Time{now}
+	for _, p := range periods {
+		dates = append(dates, p.Ago(now))
+	}
+
+	return b.formatPairQuotes(chatID, dates, func(pair apiclient.CurrencyPair, quotes []apiclient.Quote) string {
+		today := quotes[0].Rate
+		deltas := make([]string, 0, len(periods))
+		for i, period := range periods {
+			if before := quotes[i+1].Rate; before > 0 {
+				deltas = append(deltas, fmt.Sprintf("%s %+.2f%%", period.Name, (today/before-1)*100))
+			}
+		}
+		if len(deltas) == 0 {
+			return ""
+		}
+		return " (" + strings.Join(deltas, ", ") + ")"
+	})
+}
+
+// formatWeeklyRates renders rates of the chat's currency pairs with the change over the last week
+// and the range of daily rates during it
+func (b *Bot) formatWeeklyRates(chatID int64) string {
+	now := time.Now().UTC()
+	dates := []time.Time{now}
+	for i := 1; i <= 7; i++ {
+		dates = append(dates, now.AddDate(0, 0, -i))
+	}
+
+	return b.formatPairQuotes(chatID, dates, func(pair apiclient.CurrencyPair, quotes []apiclient.Quote) string {
+		today := quotes[0].Rate
+		low, high := today, today
+		for _, q := range quotes[1:] {
+			if q.Rate > 0 {
+				low, high = min(low, q.Rate), max(high, q.Rate)
+			}
+		}
+		text := " ("
+		if before := quotes[len(quotes)-1].Rate; before > 0 {
+			text += fmt.Sprintf("неделя %+.2f%%, ", (today/before-1)*100)
+		}
+		return text + fmt.Sprintf("мин %s, макс %s)", formatPrice(low, pair.Quote), formatPrice(high, pair.Quote))
+	})
+}
+
+// formatPairQuotes renders the current rate of every currency pair of the chat followed by the text
+// returned by details for the pair's rates on the given dates, the first date is the current one
+func (b *Bot) formatPairQuotes(chatID int64, dates []time.Time, details func(pair apiclient.CurrencyPair, quotes []apiclient.Quote) string) string {
+	pairs, err := b.DBClient.GetCurrencyPairs(context.Background(), chatID)
+	if err != nil {
+		slog.Error("error getting currency pairs", "err", err, "chat_id", chatID)
+		return ""
+	}
+
+	text := ""
+	for _, p := range pairs {
+		pair, err := apiclient.ParseCurrencyPair(p)
+		if err != nil {
+			slog.Warn("invalid currency pair", "pair", p, "chat_id", chatID)
+			continue
+		}
+		// Changes are calculated against end-of-day rates of the same source, a missing date has a zero rate
+		quotes, err := b.ExchangeAPI.PairQuotes(pair, dates...)
+		if err != nil {
+			slog.Warn("could not get currency pair rates", "pair", p, "err", err)
+			continue
+		}
+		text += fmt.Sprintf("%s %s", pair.Base, formatPrice(quotes[0].Rate, pair.Quote))
+		text += details(pair, quotes)
+		text += " — " + rateSourceName(quotes[0].Source) + "\n"
+	}
+	return tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, text)
+}
+
+// formatPrice renders the amount with the currency symbol or code
+func formatPrice(amount float64, currency string) string {
+	value := fmt.Sprintf("%.2f", amount)
+	if amount < 1 {
+		value = fmt.Sprintf("%.4f", amount)
+	}
+	if symbol, ok := currencySymbols[currency]; ok {
+		return value + symbol
+	}
+	return value + " " + currency
+}
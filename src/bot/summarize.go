@@ -0,0 +1,47 @@
+package bot
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const summarizeUsage = "Использование: /summarize <ссылка> или ответ командой /summarize на сообщение со ссылкой"
+
+var urlRe = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+// summarize retells the article of a link given as the argument or found in the replied message
+func summarize(b *Bot, msg *tgbotapi.Message) {
+	url := strings.TrimRight(urlRe.FindString(msg.CommandArguments()), ".,;:!?)»")
+	if url == "" && msg.ReplyToMessage != nil {
+		url = messageURL(msg.ReplyToMessage)
+	}
+	if url == "" {
+		b.replyTo(msg, summarizeUsage)
+		return
+	}
+
+	summary, err := b.Summarizer.SummarizeURL(context.Background(), url)
+	if err != nil {
+		slog.Error("error summarizing url", "url", url, "err", err)
+		b.replyTo(msg, "Не удалось пересказать статью")
+		return
+	}
+	b.replyTo(msg, "📝 "+summary)
+}
+
+// messageURL returns the first link of the message, hidden links of formatted text are checked too
+func messageURL(msg *tgbotapi.Message) string {
+	if url := urlRe.FindString(msg.Text + " " + msg.Caption); url != "" {
+		return strings.TrimRight(url, ".,;:!?)»")
+	}
+	for _, e := range append(msg.Entities, msg.CaptionEntities...) {
+		if e.Type == "text_link" && e.URL != "" {
+			return e.URL
+		}
+	}
+	return ""
+}
@@ -0,0 +1,75 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/rahfar/familybot/src/apiclient"
+)
+
+const translateUsage = "Использование: /tr [исходный>]язык <текст> или ответ командой /tr <язык> на сообщение, например\n" +
+	"  /tr fi Привет всем\n" +
+	"  /tr de>ru Guten Morgen\n" +
+	"без исходного языка он определяется автоматически"
+
+// langPairRe matches "dst" or "src>dst" with ISO 639-1 codes and optional DeepL regions, e.g. fi, de>ru or en-gb
+var langPairRe = regexp.MustCompile(`^(?i)(?:([a-z]{2,3})>)?([a-z]{2,3}(?:-[a-z]{2,4})?)$`)
+
+// translate translates the text of the command or of the replied message: /tr [src>]dst <text>
+func translate(b *Bot, msg *tgbotapi.Message) {
+	args := strings.TrimSpace(msg.CommandArguments())
+	pair, text, _ := strings.Cut(args, " ")
+	m := langPairRe.FindStringSubmatch(pair)
+	if m == nil {
+		b.replyTranslation(msg, "", "", "")
+		return
+	}
+	b.replyTranslation(msg, m[1], m[2], text)
+}
+
+// translateEng2Ru is /en2ru, an alias of /tr en>ru
+func translateEng2Ru(b *Bot, msg *tgbotapi.Message) {
+	b.replyTranslation(msg, "en", "ru", msg.CommandArguments())
+}
+
+// translateRu2Eng is /ru2en, an alias of /tr ru>en
+func translateRu2Eng(b *Bot, msg *tgbotapi.Message) {
+	b.replyTranslation(msg, "ru", "en", msg.CommandArguments())
+}
+
+// replyTranslation translates the text, or the replied message if the text is empty, and replies with the result
+func (b *Bot) replyTranslation(msg *tgbotapi.Message, sourceLang, targetLang, text string) {
+	text = strings.TrimSpace(text)
+	if text == "" && msg.ReplyToMessage != nil {
+		text = strings.TrimSpace(msg.ReplyToMessage.Text + msg.ReplyToMessage.Caption)
+	}
+	if targetLang == "" || text == "" {
+		b.replyTo(msg, translateUsage)
+		return
+	}
+
+	result, err := b.Translator.Translate(context.Background(), text, sourceLang, targetLang)
+	if err != nil {
+		slog.Error("error translating text", "err", err, "source_lang", result.SourceLang, "target_lang", targetLang)
+		if errors.Is(err, apiclient.ErrSameLanguage) {
+			b.replyTo(msg, "Текст уже на этом языке")
+		} else {
+			b.replyTo(msg, "Ошибка при переводе :(")
+		}
+		return
+	}
+	b.replyTo(msg, formatLangPair(result.SourceLang, targetLang)+"\n"+result.Text)
+}
+
+// formatLangPair renders a translation direction like "🌐 FI → RU", an unknown source language is left out
+func formatLangPair(sourceLang, targetLang string) string {
+	if sourceLang == "" {
+		return "🌐 → " + strings.ToUpper(targetLang)
+	}
+	return "🌐 " + strings.ToUpper(sourceLang) + " → " + strings.ToUpper(targetLang)
+}
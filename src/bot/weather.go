@@ -0,0 +1,267 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/rahfar/familybot/src/apiclient"
+	"github.com/rahfar/familybot/src/db"
+)
+
+func getCurrentWeather(b *Bot, msg *tgbotapi.Message) {
+	if query := strings.TrimSpace(msg.CommandArguments()); len(query) > 0 {
+		getPlaceWeather(b, msg, query)
+		return
+	}
+
+	msgConfig := tgbotapi.NewMessage(msg.Chat.ID, "")
+	weather := b.WeatherAPI.GetChatWeather(msg.Chat.ID)
+
+	// Personal location saved with /here goes last
+	if location := b.getPersonalLocation(msg.From); location != nil {
+		w, err := b.WeatherAPI.GetWeatherByCoord(location.Lat, location.Lon)
+		if err != nil || len(w.Items) == 0 {
+			slog.Warn("could not get weather", "city", location.Name, "err", err)
+		} else {
+			w.Place.Name = "📍 " + location.Name
+			weather = append(weather, *w)
+		}
+	}
+	if len(weather) > 0 {
+		for _, w := range weather {
+			msgConfig.Text += b.formatWeatherBlock(w)
+		}
+		msgConfig.ReplyToMessageID = msg.MessageID
+		msgConfig.ParseMode = tgbotapi.ModeMarkdownV2
+		b.sendMessage(msgConfig)
+		return
+	} else {
+		msgConfig = tgbotapi.NewMessage(msg.Chat.ID, "Нет данных")
+		msgConfig.ReplyToMessageID = msg.MessageID
+		b.sendMessage(msgConfig)
+		return
+	}
+}
+
+// getPlaceWeather resolves the place with geocoding and sends its forecast,
+// ambiguous names are resolved with an inline keyboard
+func getPlaceWeather(b *Bot, msg *tgbotapi.Message, query string) {
+	locations, err := b.WeatherAPI.Geocode(query)
+	if err != nil {
+		slog.Error("error calling geocoding api", "err", err, "query", query)
+		b.replyTo(msg, "Ошибка при поиске города")
+		return
+	}
+
+	switch len(locations) {
+	case 0:
+		b.replyTo(msg, "Город не найден")
+	case 1:
+		b.sendPlaceWeather(msg.Chat.ID, msg.MessageID, locations[0].Lat, locations[0].Lon, locations[0].LocalName())
+	default:
+		rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(locations))
+		for _, l := range locations {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData(formatGeoLocation(l), fmt.Sprintf("weather:%.4f:%.4f", l.Lat, l.Lon)),
+			))
+		}
+		msgConfig := tgbotapi.NewMessage(msg.Chat.ID, "Уточните город:")
+		msgConfig.ReplyToMessageID = msg.MessageID
+		msgConfig.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+		b.sendMessage(msgConfig)
+	}
+}
+
+// onWeatherCallback handles the choice of a place made with the inline keyboard
+func onWeatherCallback(b *Bot, query *tgbotapi.CallbackQuery, data string) {
+	parts := strings.Split(data, ":")
+	if len(parts) != 2 {
+		slog.Error("unexpected weather callback data", "data", data)
+		return
+	}
+	lat, err1 := strconv.ParseFloat(parts[0], 64)
+	lon, err2 := strconv.ParseFloat(parts[1], 64)
+	if err1 != nil || err2 != nil {
+		slog.Error("unexpected weather callback data", "data", data)
+		return
+	}
+
+	b.deleteMessage(query.Message.Chat.ID, query.Message.MessageID)
+	replyTo, name := 0, ""
+	if request := query.Message.ReplyToMessage; request != nil {
+		replyTo = request.MessageID
+		name = b.chosenPlaceName(strings.TrimSpace(request.CommandArguments()), data)
+	}
+	b.sendPlaceWeather(query.Message.Chat.ID, replyTo, lat, lon, name)
+}
+
+// chosenPlaceName geocodes the query again to get the local name of the place chosen with the inline keyboard,
+// the place is matched by coordinates in the callback data. Geocoding results are cached, so no request is made
+// in the usual case. An empty string is returned if the place is not found
+func (b *Bot) chosenPlaceName(query, data string) string {
+	locations, err := b.WeatherAPI.Geocode(query)
+	if err != nil {
+		slog.Warn("could not geocode chosen place", "err", err, "query", query)
+		return ""
+	}
+	for _, l := range locations {
+		if strings.HasPrefix(data, fmt.Sprintf("%.4f:%.4f", l.Lat, l.Lon)) {
+			return l.LocalName()
+		}
+	}
+	return ""
+}
+
+func (b *Bot) sendPlaceWeather(chatID int64, replyTo int, lat, lon float64, name string) {
+	w, err := b.WeatherAPI.GetWeatherByCoord(lat, lon)
+	if err != nil || len(w.Items) == 0 {
+		slog.Error("could not get weather", "lat", lat, "lon", lon, "err", err)
+		msgConfig := tgbotapi.NewMessage(chatID, "Нет данных")
+		msgConfig.ReplyToMessageID = replyTo
+		b.sendMessage(msgConfig)
+		return
+	}
+	if name != "" {
+		w.Place.Name = name
+	}
+
+	msgConfig := tgbotapi.NewMessage(chatID, b.formatWeatherBlock(*w)+formatHourlyForecast(*w))
+	msgConfig.ReplyToMessageID = replyTo
+	msgConfig.ParseMode = tgbotapi.ModeMarkdownV2
+	b.sendMessage(msgConfig)
+}
+
+// onLocation sends the forecast for a shared location or live location,
+// live location updates arrive as edited messages and are ignored
+func onLocation(b *Bot, msg *tgbotapi.Message) {
+	// Round coordinates so nearby locations share the weather cache
+	lat := math.Round(msg.Location.Latitude*100) / 100
+	lon := math.Round(msg.Location.Longitude*100) / 100
+
+	w, err := b.WeatherAPI.GetWeatherByCoord(lat, lon)
+	if err != nil || len(w.Items) == 0 {
+		slog.Error("could not get weather", "lat", lat, "lon", lon, "err", err)
+		b.replyTo(msg, "Нет данных")
+		return
+	}
+
+	ctx := context.Background()
+	requested, err := b.DBClient.PopUserLocationRequest(ctx, msg.From.ID)
+	if err != nil {
+		slog.Error("error checking location request", "err", err, "user_id", msg.From.ID)
+	}
+	if requested {
+		// Open-Meteo names places by coordinates, so the name is looked up with reverse geocoding
+		location := db.UserLocation{Name: w.Place.Name, Lat: lat, Lon: lon}
+		if place, err := b.WeatherAPI.ReverseGeocode(lat, lon); err != nil {
+			slog.Warn("could not reverse geocode location", "lat", lat, "lon", lon, "err", err)
+		} else if place != nil {
+			location.Name = place.LocalName()
+			w.Place.Name = location.Name
+		}
+		text := fmt.Sprintf("Место сохранено: %s", location.Name)
+		if err := b.DBClient.SetUserLocation(ctx, msg.From.ID, location); err != nil {
+			slog.Error("error saving user location", "err", err, "user_id", msg.From.ID)
+			text = "Ошибка при сохранении места"
+		}
+		msgConfig := tgbotapi.NewMessage(msg.Chat.ID, text)
+		msgConfig.ReplyToMessageID = msg.MessageID
+		msgConfig.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
+		b.sendMessage(msgConfig)
+	}
+
+	msgConfig := tgbotapi.NewMessage(msg.Chat.ID, b.formatWeatherBlock(*w)+formatHourlyForecast(*w))
+	msgConfig.ReplyToMessageID = msg.MessageID
+	msgConfig.ParseMode = tgbotapi.ModeMarkdownV2
+	b.sendMessage(msgConfig)
+}
+
+// setPersonalLocation waits for the next location shared by the user and saves it as their personal city
+func setPersonalLocation(b *Bot, msg *tgbotapi.Message) {
+	ctx := context.Background()
+
+	if strings.TrimSpace(msg.CommandArguments()) == "off" {
+		if err := b.DBClient.DeleteUserLocation(ctx, msg.From.ID); err != nil {
+			slog.Error("error deleting user location", "err", err, "user_id", msg.From.ID)
+			b.replyTo(msg, "Ошибка при удалении места")
+			return
+		}
+		b.replyTo(msg, "Место удалено")
+		return
+	}
+
+	if err := b.DBClient.RequestUserLocation(ctx, msg.From.ID); err != nil {
+		slog.Error("error requesting user location", "err", err, "user_id", msg.From.ID)
+		b.replyTo(msg, "Ошибка при сохранении места")
+		return
+	}
+
+	msgConfig := tgbotapi.NewMessage(msg.Chat.ID, "Отправьте геопозицию, она будет использоваться в /weather")
+	msgConfig.ReplyToMessageID = msg.MessageID
+	// Location request buttons are supported only in private chats
+	if msg.Chat.IsPrivate() {
+		keyboard := tgbotapi.NewOneTimeReplyKeyboard(
+			tgbotapi.NewKeyboardButtonRow(tgbotapi.NewKeyboardButtonLocation("📍 Отправить геопозицию")),
+		)
+		msgConfig.ReplyMarkup = keyboard
+	}
+	b.sendMessage(msgConfig)
+}
+
+// getPersonalLocation returns the location saved by the user with /here
+func (b *Bot) getPersonalLocation(user *tgbotapi.User) *db.UserLocation {
+	if user == nil {
+		return nil
+	}
+	location, err := b.DBClient.GetUserLocation(context.Background(), user.ID)
+	if err != nil {
+		slog.Error("error getting user location", "err", err, "user_id", user.ID)
+		return nil
+	}
+	return location
+}
+
+// formatHourlyForecast renders forecast items left until the end of the local day
+func formatHourlyForecast(f apiclient.Forecast) string {
+	location := f.Location()
+	now := time.Now().In(location)
+	text := ""
+	for _, item := range f.Items {
+		t := item.Time.In(location)
+		if t.Before(now.Add(-3*time.Hour)) || item.Condition.Description == "" {
+			continue
+		}
+		if t.YearDay() != now.YearDay() {
+			break
+		}
+		text += fmt.Sprintf(
+			"  %s %d°C, %s (%d%%)\n",
+			t.Format("15:04"),
+			int(item.Temp),
+			item.Condition.Description,
+			int(item.Pop*100),
+		)
+	}
+	if len(text) == 0 {
+		return ""
+	}
+	return "_По часам:_\n" + tgbotapi.EscapeText(tgbotapi.ModeMarkdownV2, text)
+}
+
+func formatGeoLocation(l apiclient.GeoLocation) string {
+	parts := []string{l.LocalName()}
+	if l.State != "" {
+		parts = append(parts, l.State)
+	}
+	if l.Country != "" {
+		parts = append(parts, l.Country)
+	}
+	return strings.Join(parts, ", ")
+}
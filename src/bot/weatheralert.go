@@ -0,0 +1,347 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/rahfar/familybot/src/apiclient"
+	"github.com/rahfar/familybot/src/db"
+	"github.com/rahfar/familybot/src/metrics"
+)
+
+const (
+	weatherAlertInterval = 3 * time.Hour
+	// Only events within this horizon are reported, later forecasts are too unreliable
+	weatherAlertHorizon = 48 * time.Hour
+)
+
+// weatherEvent is a crossed threshold found in the forecast
+type weatherEvent struct {
+	// Key identifies the event for de-duplication
+	Key  string
+	Text string
+}
+
+func (b *Bot) weatherAlertJob() {
+	slog.Info("starting weather alert job")
+	for {
+		b.checkWeatherAlerts()
+		time.Sleep(weatherAlertInterval)
+	}
+}
+
+// checkWeatherAlerts looks for severe weather in the cached forecasts and notifies subscribed chats
+func (b *Bot) checkWeatherAlerts() {
+	ctx := context.Background()
+	chatIDs, err := b.DBClient.GetWeatherAlertChats(ctx)
+	if err != nil {
+		slog.Error("error getting weather alert chats", "err", err)
+		return
+	}
+	if len(chatIDs) == 0 {
+		return
+	}
+
+	for _, chatID := range chatIDs {
+		settings, err := b.DBClient.GetWeatherAlertSettings(ctx, chatID)
+		if err != nil {
+			slog.Error("error getting weather alert settings", "err", err, "chat_id", chatID)
+			continue
+		}
+		// Quiet hours are in the time zone of the chat's first city, events are not marked as sent
+		// during quiet hours and will be reported on the next check
+		weather := b.WeatherAPI.GetChatWeather(chatID)
+		location := time.Local
+		if len(weather) > 0 {
+			location = weather[0].Location()
+		}
+		if inQuietHours(time.Now().In(location).Hour(), settings.QuietFrom, settings.QuietTo) {
+			continue
+		}
+
+		text := ""
+		for _, w := range weather {
+			events := b.detectWeatherEvents(w, settings)
+			if event := b.detectAirQualityEvent(w, settings); event != nil {
+				events = append(events, *event)
+			}
+			for _, event := range events {
+				isNew, err := b.DBClient.MarkWeatherAlertSent(ctx, chatID, event.Key)
+				if err != nil {
+					slog.Error("error marking weather alert", "err", err, "chat_id", chatID, "event", event.Key)
+					continue
+				}
+				if isNew {
+					text += event.Text + "\n"
+				}
+			}
+		}
+		if len(text) == 0 {
+			continue
+		}
+
+		metrics.WeatherAlertCounter.Inc()
+		b.sendMessage(tgbotapi.NewMessage(chatID, "⚠️ Погодное предупреждение\n"+text))
+	}
+}
+
+// detectWeatherEvents finds crossed thresholds in the forecast of a city
+func (b *Bot) detectWeatherEvents(w apiclient.Forecast, s db.WeatherAlertSettings) []weatherEvent {
+	events := make([]weatherEvent, 0)
+	until := time.Now().Add(weatherAlertHorizon)
+	summary := apiclient.NewWeatherSummary(w)
+	location := summary.Location
+	city := summary.City
+
+	// today's day is partial, its max is taken only from the remaining hours and can't be compared
+	now := time.Now().In(location)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location)
+
+	days := summary.Days
+	for i, d := range days {
+		if d.Date.After(until) {
+			break
+		}
+		date := fmt.Sprintf("%s %s", weekdaysShort[d.Date.Weekday()], d.Date.Format("02.01"))
+		if d.MinTemp <= s.FrostTemp {
+			events = append(events, weatherEvent{
+				Key:  fmt.Sprintf("%s:frost:%s", city, d.Date.Format("2006-01-02")),
+				Text: fmt.Sprintf("🥶 %s: мороз до %d°C, %s", city, int(d.MinTemp), date),
+			})
+		}
+		if d.MaxTemp >= s.HeatTemp {
+			events = append(events, weatherEvent{
+				Key:  fmt.Sprintf("%s:heat:%s", city, d.Date.Format("2006-01-02")),
+				Text: fmt.Sprintf("🥵 %s: жара до %d°C, %s", city, int(d.MaxTemp), date),
+			})
+		}
+		if i > 0 && !days[i-1].Date.Equal(today) && days[i-1].MaxTemp-d.MaxTemp >= s.TempDrop {
+			events = append(events, weatherEvent{
+				Key: fmt.Sprintf("%s:drop:%s", city, d.Date.Format("2006-01-02")),
+				Text: fmt.Sprintf(
+					"📉 %s: резкое похолодание с %d°C до %d°C, %s",
+					city, int(days[i-1].MaxTemp), int(d.MaxTemp), date,
+				),
+			})
+		}
+	}
+
+	for _, item := range w.Items {
+		t := item.Time.In(location)
+		if t.After(until) {
+			break
+		}
+		date := t.Format("2006-01-02")
+		when := fmt.Sprintf("%s %s", weekdaysShort[t.Weekday()], t.Format("02.01 15:04"))
+		if s.WindGust > 0 && item.WindGust >= s.WindGust {
+			events = append(events, weatherEvent{
+				Key:  fmt.Sprintf("%s:wind:%s", city, date),
+				Text: fmt.Sprintf("💨 %s: порывы ветра до %.0f м/с, %s", city, item.WindGust, when),
+			})
+		}
+		if item.Pop < s.PopThreshold {
+			continue
+		}
+		switch item.Condition.Kind {
+		case apiclient.ConditionHeavyRain, apiclient.ConditionFreezingRain, apiclient.ConditionThunderstorm:
+			events = append(events, weatherEvent{
+				Key:  fmt.Sprintf("%s:rain:%s", city, date),
+				Text: fmt.Sprintf("🌧 %s: %s (%d%%), %s", city, item.Condition.Description, int(item.Pop*100), when),
+			})
+		case apiclient.ConditionHeavySnow:
+			events = append(events, weatherEvent{
+				Key:  fmt.Sprintf("%s:snow:%s", city, date),
+				Text: fmt.Sprintf("🌨 %s: %s (%d%%), %s", city, item.Condition.Description, int(item.Pop*100), when),
+			})
+		}
+	}
+
+	// The same event found in several forecast items is reported once
+	unique := make([]weatherEvent, 0, len(events))
+	seen := make(map[string]bool)
+	for _, e := range events {
+		if !seen[e.Key] {
+			seen[e.Key] = true
+			unique = append(unique, e)
+		}
+	}
+	return unique
+}
+
+// detectAirQualityEvent checks if the current air quality of a city reached the threshold,
+// the event is reported once per local day
+func (b *Bot) detectAirQualityEvent(w apiclient.Forecast, s db.WeatherAlertSettings) *weatherEvent {
+	if s.AQI <= 0 {
+		return nil
+	}
+	aq, err := b.WeatherAPI.GetAirQuality(w.Place.Lat, w.Place.Lon)
+	if err != nil {
+		slog.Warn("could not get air quality", "city", w.Place.Name, "err", err)
+		return nil
+	}
+	if aq.AQI < s.AQI {
+		return nil
+	}
+	return &weatherEvent{
+		Key: fmt.Sprintf("%s:aqi:%s", w.Place.Name, time.Now().In(w.Location()).Format("2006-01-02")),
+		Text: fmt.Sprintf(
+			"😷 %s: качество воздуха %s (AQI %d), PM2.5 %.0f мкг/м³",
+			w.Place.Name, aq.Level(), aq.AQI, aq.PM25,
+		),
+	}
+}
+
+// inQuietHours checks if the hour falls into the quiet period, which may wrap around midnight
+func inQuietHours(hour, from, to int) bool {
+	switch {
+	case from == to:
+		return false
+	case from < to:
+		return hour >= from && hour < to
+	default:
+		return hour >= from || hour < to
+	}
+}
+
+// manageWeatherAlerts shows and changes weather alert settings of the chat
+func manageWeatherAlerts(b *Bot, msg *tgbotapi.Message) {
+	ctx := context.Background()
+	chatID := msg.Chat.ID
+	args := strings.Fields(msg.CommandArguments())
+
+	settings, err := b.DBClient.GetWeatherAlertSettings(ctx, chatID)
+	if err != nil {
+		slog.Error("error getting weather alert settings", "err", err, "chat_id", chatID)
+		b.replyTo(msg, "Ошибка при получении настроек")
+		return
+	}
+
+	if len(args) == 0 {
+		enabled, err := b.DBClient.IsWeatherAlertsEnabled(ctx, chatID)
+		if err != nil {
+			slog.Error("error checking weather alerts", "err", err, "chat_id", chatID)
+		}
+		b.replyTo(msg, formatWeatherAlertSettings(enabled, settings))
+		return
+	}
+
+	switch args[0] {
+	case "on":
+		err = b.DBClient.EnableWeatherAlerts(ctx, chatID)
+	case "off":
+		err = b.DBClient.DisableWeatherAlerts(ctx, chatID)
+	case "quiet":
+		var from, to int
+		if len(args) != 2 {
+			b.replyTo(msg, "Использование: /weatheralerts quiet <с>-<до>, например quiet 22-8")
+			return
+		}
+		if _, scanErr := fmt.Sscanf(args[1], "%d-%d", &from, &to); scanErr != nil || from < 0 || from > 23 || to < 0 || to > 23 {
+			b.replyTo(msg, "Неверный формат тихих часов")
+			return
+		}
+		settings.QuietFrom, settings.QuietTo = from, to
+		err = b.DBClient.SetWeatherAlertSettings(ctx, chatID, settings)
+	case "aqi":
+		if len(args) != 2 {
+			b.replyTo(msg, "Использование: /weatheralerts aqi <1-5>, 0 отключает")
+			return
+		}
+		value, parseErr := strconv.Atoi(args[1])
+		if parseErr != nil || value < 0 || value > 5 {
+			b.replyTo(msg, "Неверное значение, AQI от 1 до 5")
+			return
+		}
+		settings.AQI = value
+		err = b.DBClient.SetWeatherAlertSettings(ctx, chatID, settings)
+	case "frost", "heat", "gust", "pop", "drop":
+		if len(args) != 2 {
+			b.replyTo(msg, fmt.Sprintf("Использование: /weatheralerts %s <значение>", args[0]))
+			return
+		}
+		value, parseErr := strconv.ParseFloat(strings.Replace(args[1], ",", ".", 1), 64)
+		if parseErr != nil {
+			b.replyTo(msg, "Неверное значение")
+			return
+		}
+		switch args[0] {
+		case "frost":
+			settings.FrostTemp = value
+		case "heat":
+			settings.HeatTemp = value
+		case "gust":
+			settings.WindGust = value
+		case "pop":
+			if value < 0 || value > 100 {
+				b.replyTo(msg, "Неверное значение, вероятность от 0 до 100%")
+				return
+			}
+			settings.PopThreshold = value / 100
+		case "drop":
+			settings.TempDrop = value
+		}
+		if (args[0] == "gust" || args[0] == "drop") && value <= 0 {
+			b.replyTo(msg, "Неверное значение, оно должно быть больше нуля")
+			return
+		}
+		if settings.FrostTemp >= settings.HeatTemp {
+			b.replyTo(msg, fmt.Sprintf("Порог мороза (%.0f°C) должен быть ниже порога жары (%.0f°C)", settings.FrostTemp, settings.HeatTemp))
+			return
+		}
+		err = b.DBClient.SetWeatherAlertSettings(ctx, chatID, settings)
+	default:
+		b.replyTo(msg,
+			"Использование: /weatheralerts [on|off]\n"+
+				"/weatheralerts frost|heat|gust|pop|drop <значение>\n"+
+				"/weatheralerts aqi <1-5>\n"+
+				"/weatheralerts quiet <с>-<до>",
+		)
+		return
+	}
+
+	if err != nil {
+		slog.Error("error saving weather alert settings", "err", err, "chat_id", chatID)
+		b.replyTo(msg, "Ошибка при сохранении настроек")
+		return
+	}
+	b.replyTo(msg, "Настройки сохранены")
+}
+
+func formatWeatherAlertSettings(enabled bool, s db.WeatherAlertSettings) string {
+	status := "выключены"
+	if enabled {
+		status = "включены"
+	}
+	return fmt.Sprintf(
+		"Погодные предупреждения %s\n"+
+			"Мороз (frost): %.0f°C\n"+
+			"Жара (heat): %.0f°C\n"+
+			"Порывы ветра (gust): %.0f м/с\n"+
+			"Вероятность сильных осадков (pop): %.0f%%\n"+
+			"Похолодание за день (drop): %.0f°C\n"+
+			"Качество воздуха (aqi): %s\n"+
+			"Тихие часы (quiet): %d-%d по времени первого города чата",
+		status,
+		s.FrostTemp,
+		s.HeatTemp,
+		s.WindGust,
+		s.PopThreshold*100,
+		s.TempDrop,
+		formatAQIThreshold(s.AQI),
+		s.QuietFrom,
+		s.QuietTo,
+	)
+}
+
+func formatAQIThreshold(aqi int) string {
+	if aqi <= 0 {
+		return "выключено"
+	}
+	return fmt.Sprintf("AQI %d (%s)", aqi, apiclient.AirQuality{AQI: aqi}.Level())
+}
@@ -0,0 +1,261 @@
+// Package chart renders simple time series charts to PNG without external dependencies
+package chart
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"time"
+)
+
+// Point is a single value of a time series
+type Point struct {
+	X time.Time
+	Y float64
+}
+
+// Series is a named set of points drawn with one color
+type Series struct {
+	Name   string
+	Color  color.RGBA
+	Points []Point
+}
+
+// Chart describes a chart with lines on the left axis and bars with values in the 0..1 range
+type Chart struct {
+	Width  int
+	Height int
+	// Lines are drawn against the left Y axis
+	Lines []Series
+	// Bars are drawn from the bottom of the plot, a value of 1 fills the whole plot height
+	Bars []Series
+	// Separators are vertical lines, e.g. day boundaries
+	Separators []time.Time
+	// Labels are drawn below the plot at the given moments
+	Labels map[time.Time]string
+	// YFormat formats the left axis ticks
+	YFormat string
+}
+
+var (
+	// Palette contains distinguishable colors for series
+	Palette = []color.RGBA{
+		{220, 50, 47, 255},
+		{38, 139, 210, 255},
+		{133, 153, 0, 255},
+		{203, 75, 22, 255},
+		{108, 113, 196, 255},
+		{140, 90, 60, 255},
+		{60, 60, 60, 255},
+		{181, 137, 0, 255},
+	}
+
+	backgroundColor = color.RGBA{255, 255, 255, 255}
+	gridColor       = color.RGBA{225, 225, 225, 255}
+	separatorColor  = color.RGBA{150, 150, 150, 255}
+	textColor       = color.RGBA{80, 80, 80, 255}
+)
+
+const (
+	marginLeft   = 60
+	marginRight  = 50
+	marginTop    = 20
+	marginBottom = 35
+)
+
+// Render draws the chart and encodes it as PNG
+func (c *Chart) Render(w io.Writer) error {
+	if c.Width == 0 {
+		c.Width = 1000
+	}
+	if c.Height == 0 {
+		c.Height = 500
+	}
+	if c.YFormat == "" {
+		c.YFormat = "%.0f"
+	}
+
+	minX, maxX, minY, maxY, ok := c.bounds()
+	if !ok {
+		return fmt.Errorf("no data to draw")
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, c.Width, c.Height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{backgroundColor}, image.Point{}, draw.Src)
+
+	plot := image.Rect(marginLeft, marginTop, c.Width-marginRight, c.Height-marginBottom)
+	xPos := func(t time.Time) int {
+		span := maxX.Sub(minX)
+		if span == 0 {
+			return plot.Min.X
+		}
+		return plot.Min.X + int(float64(plot.Dx())*float64(t.Sub(minX))/float64(span))
+	}
+
+	// Left axis grid and ticks
+	step := niceStep(maxY-minY, 6)
+	minY = math.Floor(minY/step) * step
+	maxY = math.Ceil(maxY/step) * step
+	if maxY == minY {
+		maxY = minY + step
+	}
+	yPos := func(v float64) int {
+		return plot.Max.Y - int(float64(plot.Dy())*(v-minY)/(maxY-minY))
+	}
+	for v := minY; v <= maxY+step/2; v += step {
+		y := yPos(v)
+		drawHLine(img, plot.Min.X, plot.Max.X, y, gridColor)
+		label := fmt.Sprintf(c.YFormat, v)
+		drawText(img, plot.Min.X-8-textWidth(label), y-glyphHeight*fontScale/2, label, textColor)
+	}
+
+	// Right axis for bars
+	if len(c.Bars) > 0 {
+		for _, v := range []float64{0, 0.5, 1} {
+			label := fmt.Sprintf("%.0f%%", v*100)
+			y := plot.Max.Y - int(float64(plot.Dy())*v)
+			drawText(img, plot.Max.X+8, y-glyphHeight*fontScale/2, label, textColor)
+		}
+	}
+
+	// Bars
+	for i, s := range c.Bars {
+		barColor := color.NRGBA{s.Color.R, s.Color.G, s.Color.B, 70}
+		slot := plot.Dx() / max(len(s.Points), 1)
+		width := max(slot*2/3/len(c.Bars), 1)
+		for _, p := range s.Points {
+			if p.Y <= 0 {
+				continue
+			}
+			x := xPos(p.X) - slot/3 + i*width
+			h := int(float64(plot.Dy()) * math.Min(p.Y, 1))
+			rect := image.Rect(x, plot.Max.Y-h, x+width, plot.Max.Y).Intersect(plot)
+			draw.Draw(img, rect, &image.Uniform{barColor}, image.Point{}, draw.Over)
+		}
+	}
+
+	// Separators and labels
+	for _, t := range c.Separators {
+		if t.Before(minX) || t.After(maxX) {
+			continue
+		}
+		drawVLine(img, xPos(t), plot.Min.Y, plot.Max.Y, separatorColor)
+	}
+	for t, label := range c.Labels {
+		if t.Before(minX) || t.After(maxX) {
+			continue
+		}
+		drawText(img, xPos(t)-textWidth(label)/2, plot.Max.Y+10, label, textColor)
+	}
+
+	// Lines
+	for _, s := range c.Lines {
+		for i := 1; i < len(s.Points); i++ {
+			p1, p2 := s.Points[i-1], s.Points[i]
+			drawLine(img, xPos(p1.X), yPos(p1.Y), xPos(p2.X), yPos(p2.Y), s.Color)
+		}
+	}
+
+	// Plot frame
+	drawHLine(img, plot.Min.X, plot.Max.X, plot.Max.Y, separatorColor)
+	drawVLine(img, plot.Min.X, plot.Min.Y, plot.Max.Y, separatorColor)
+
+	return png.Encode(w, img)
+}
+
+// bounds returns the range of the data, bars are only used for the X range
+func (c *Chart) bounds() (minX, maxX time.Time, minY, maxY float64, ok bool) {
+	minY, maxY = math.Inf(1), math.Inf(-1)
+	for _, series := range [][]Series{c.Lines, c.Bars} {
+		for _, s := range series {
+			for _, p := range s.Points {
+				if !ok || p.X.Before(minX) {
+					minX = p.X
+				}
+				if !ok || p.X.After(maxX) {
+					maxX = p.X
+				}
+				ok = true
+			}
+		}
+	}
+	for _, s := range c.Lines {
+		for _, p := range s.Points {
+			minY = math.Min(minY, p.Y)
+			maxY = math.Max(maxY, p.Y)
+		}
+	}
+	if math.IsInf(minY, 0) {
+		minY, maxY = 0, 1
+	}
+	return minX, maxX, minY, maxY, ok
+}
+
+// niceStep returns a round step that splits the span into about n parts
+func niceStep(span float64, n int) float64 {
+	if span <= 0 {
+		return 1
+	}
+	raw := span / float64(n)
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if raw <= m*magnitude {
+			return m * magnitude
+		}
+	}
+	return 10 * magnitude
+}
+
+func drawHLine(img *image.RGBA, x1, x2, y int, c color.RGBA) {
+	for x := x1; x <= x2; x++ {
+		img.SetRGBA(x, y, c)
+	}
+}
+
+func drawVLine(img *image.RGBA, x, y1, y2 int, c color.RGBA) {
+	for y := y1; y <= y2; y++ {
+		img.SetRGBA(x, y, c)
+	}
+}
+
+// drawLine draws a 2px wide line with Bresenham's algorithm
+func drawLine(img *image.RGBA, x1, y1, x2, y2 int, c color.RGBA) {
+	dx := abs(x2 - x1)
+	dy := -abs(y2 - y1)
+	sx, sy := 1, 1
+	if x1 > x2 {
+		sx = -1
+	}
+	if y1 > y2 {
+		sy = -1
+	}
+	e := dx + dy
+	for {
+		img.SetRGBA(x1, y1, c)
+		img.SetRGBA(x1+1, y1, c)
+		img.SetRGBA(x1, y1+1, c)
+		if x1 == x2 && y1 == y2 {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x1 += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y1 += sy
+		}
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,66 @@
+package chart
+
+import (
+	"image"
+	"image/color"
+)
+
+// glyphs is a tiny 3x5 bitmap font with characters needed for axis labels,
+// every row is encoded with the three lowest bits
+var glyphs = map[rune][5]uint8{
+	'0': {0b111, 0b101, 0b101, 0b101, 0b111},
+	'1': {0b010, 0b110, 0b010, 0b010, 0b111},
+	'2': {0b111, 0b001, 0b111, 0b100, 0b111},
+	'3': {0b111, 0b001, 0b111, 0b001, 0b111},
+	'4': {0b101, 0b101, 0b111, 0b001, 0b001},
+	'5': {0b111, 0b100, 0b111, 0b001, 0b111},
+	'6': {0b111, 0b100, 0b111, 0b101, 0b111},
+	'7': {0b111, 0b001, 0b001, 0b001, 0b001},
+	'8': {0b111, 0b101, 0b111, 0b101, 0b111},
+	'9': {0b111, 0b101, 0b111, 0b001, 0b111},
+	'-': {0b000, 0b000, 0b111, 0b000, 0b000},
+	'+': {0b000, 0b010, 0b111, 0b010, 0b000},
+	'.': {0b000, 0b000, 0b000, 0b000, 0b010},
+	':': {0b000, 0b010, 0b000, 0b010, 0b000},
+	'/': {0b001, 0b001, 0b010, 0b100, 0b100},
+	'%': {0b101, 0b001, 0b010, 0b100, 0b101},
+	'°': {0b111, 0b101, 0b111, 0b000, 0b000},
+	' ': {0b000, 0b000, 0b000, 0b000, 0b000},
+}
+
+const (
+	glyphWidth  = 3
+	glyphHeight = 5
+	fontScale   = 2
+)
+
+// textWidth returns the width of the rendered text in pixels
+func textWidth(text string) int {
+	n := len([]rune(text))
+	if n == 0 {
+		return 0
+	}
+	return (n*(glyphWidth+1) - 1) * fontScale
+}
+
+// drawText draws text with its top left corner at (x, y), unknown characters are skipped
+func drawText(img *image.RGBA, x, y int, text string, c color.RGBA) {
+	for _, r := range text {
+		glyph, ok := glyphs[r]
+		if ok {
+			for row := 0; row < glyphHeight; row++ {
+				for col := 0; col < glyphWidth; col++ {
+					if glyph[row]&(1<<(glyphWidth-1-col)) == 0 {
+						continue
+					}
+					for dy := 0; dy < fontScale; dy++ {
+						for dx := 0; dx < fontScale; dx++ {
+							img.SetRGBA(x+col*fontScale+dx, y+row*fontScale+dy, c)
+						}
+					}
+				}
+			}
+		}
+		x += (glyphWidth + 1) * fontScale
+	}
+}
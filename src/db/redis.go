@@ -1,11 +1,13 @@
 package db
 
 import (
+	"cmp"
 	"context"
 	"crypto/md5"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -68,17 +70,59 @@ func (c *Client) CurrencyKey(date time.Time) string {
 	return "currencyapi_" + date.Format("2006-01-02")
 }
 
+// RatesKey generates a cache key for exchange rates provider data
+func (c *Client) RatesKey(provider string, date time.Time) string {
+	return "rates_" + provider + "_" + date.Format("2006-01-02")
+}
+
 // WeatherKey generates a cache key for weather API data
 func (c *Client) WeatherKey(lat, lon float64) string {
 	return fmt.Sprintf("openweatherapi_lat=%f&lon=%f", lat, lon)
 }
 
-// DeepLKey generates a cache key for DeepL translation API data
-func (c *Client) DeepLKey(text []string) string {
-	concatenatedString := strings.Join(text, "")
-	hashBytes := md5.Sum([]byte(concatenatedString))
-	hashSlice := hashBytes[:]
-	return "deeplapi_" + hex.EncodeToString(hashSlice)
+// OpenMeteoKey generates a cache key for Open-Meteo API data
+func (c *Client) OpenMeteoKey(lat, lon float64) string {
+	return fmt.Sprintf("openmeteoapi_lat=%f&lon=%f", lat, lon)
+}
+
+// AirPollutionKey generates a cache key for air pollution API data
+func (c *Client) AirPollutionKey(lat, lon float64) string {
+	return fmt.Sprintf("airpollutionapi_lat=%f&lon=%f", lat, lon)
+}
+
+// OpenMeteoAirQualityKey generates a cache key for Open-Meteo air quality API data
+func (c *Client) OpenMeteoAirQualityKey(lat, lon float64) string {
+	return fmt.Sprintf("openmeteoairqualityapi_lat=%f&lon=%f", lat, lon)
+}
+
+// GeocodingKey generates a cache key for geocoding API data
+func (c *Client) GeocodingKey(query string) string {
+	return "geo_q=" + query
+}
+
+// ReverseGeocodingKey generates a cache key for reverse geocoding API data
+func (c *Client) ReverseGeocodingKey(lat, lon float64) string {
+	return fmt.Sprintf("geo_lat=%f&lon=%f", lat, lon)
+}
+
+// DeepLKey generates a cache key for the DeepL translation of a text, an empty source language is auto-detected.
+// The glossary ID is a part of the key, so changed glossaries do not return stale translations
+func (c *Client) DeepLKey(text, sourceLang, targetLang, formality, glossaryID string) string {
+	hashBytes := md5.Sum([]byte(text))
+	langs := strings.ToLower(cmp.Or(sourceLang, "auto") + "_" + targetLang)
+	if formality != "" {
+		langs += "_" + formality
+	}
+	if glossaryID != "" {
+		langs += "_" + glossaryID
+	}
+	return "deeplapi_" + langs + "_" + hex.EncodeToString(hashBytes[:])
+}
+
+// SummaryURLKey generates a cache key for the summary of a web page
+func (c *Client) SummaryURLKey(url string) string {
+	hashBytes := md5.Sum([]byte(url))
+	return "summary_url_" + hex.EncodeToString(hashBytes[:])
 }
 
 // Domain-specific cache operations
@@ -93,6 +137,26 @@ func (c *Client) SetCurrencyRates(ctx context.Context, date time.Time, data inte
 	return c.Set(ctx, c.CurrencyKey(date), data, 7*24*time.Hour)
 }
 
+// GetRatesData retrieves cached exchange rates provider data for a specific date
+func (c *Client) GetRatesData(ctx context.Context, provider string, date time.Time) (string, error) {
+	return c.Get(ctx, c.RatesKey(provider, date))
+}
+
+// SetRatesData caches exchange rates provider data for a specific date
+func (c *Client) SetRatesData(ctx context.Context, provider string, date time.Time, data interface{}, ttl time.Duration) error {
+	return c.Set(ctx, c.RatesKey(provider, date), data, ttl)
+}
+
+// SetRatesProviderExhausted marks that the rates provider ran out of quota, the mark expires after ttl
+func (c *Client) SetRatesProviderExhausted(ctx context.Context, provider string, ttl time.Duration) error {
+	return c.Set(ctx, "rates_provider_exhausted:"+provider, time.Now().Unix(), ttl)
+}
+
+// IsRatesProviderExhausted checks if the rates provider ran out of quota recently
+func (c *Client) IsRatesProviderExhausted(ctx context.Context, provider string) (bool, error) {
+	return c.Exists(ctx, "rates_provider_exhausted:"+provider)
+}
+
 // GetWeatherData retrieves cached weather data for specific coordinates
 func (c *Client) GetWeatherData(ctx context.Context, lat, lon float64) (string, error) {
 	return c.Get(ctx, c.WeatherKey(lat, lon))
@@ -103,14 +167,104 @@ func (c *Client) SetWeatherData(ctx context.Context, lat, lon float64, data inte
 	return c.Set(ctx, c.WeatherKey(lat, lon), data, 3*time.Hour)
 }
 
-// GetTranslation retrieves cached translation for the given text
-func (c *Client) GetTranslation(ctx context.Context, text []string) (string, error) {
-	return c.Get(ctx, c.DeepLKey(text))
+// GetOpenMeteoData retrieves cached Open-Meteo data for specific coordinates
+func (c *Client) GetOpenMeteoData(ctx context.Context, lat, lon float64) (string, error) {
+	return c.Get(ctx, c.OpenMeteoKey(lat, lon))
 }
 
-// SetTranslation caches translation with 24-hour TTL
-func (c *Client) SetTranslation(ctx context.Context, text []string, translation interface{}) error {
-	return c.Set(ctx, c.DeepLKey(text), translation, 24*time.Hour)
+// SetOpenMeteoData caches Open-Meteo data for specific coordinates with 3-hour TTL
+func (c *Client) SetOpenMeteoData(ctx context.Context, lat, lon float64, data interface{}) error {
+	return c.Set(ctx, c.OpenMeteoKey(lat, lon), data, 3*time.Hour)
+}
+
+// GetAirPollutionData retrieves cached air pollution data for specific coordinates
+func (c *Client) GetAirPollutionData(ctx context.Context, lat, lon float64) (string, error) {
+	return c.Get(ctx, c.AirPollutionKey(lat, lon))
+}
+
+// SetAirPollutionData caches air pollution data for specific coordinates with 1-hour TTL
+func (c *Client) SetAirPollutionData(ctx context.Context, lat, lon float64, data interface{}) error {
+	return c.Set(ctx, c.AirPollutionKey(lat, lon), data, time.Hour)
+}
+
+// GetOpenMeteoAirQualityData retrieves cached Open-Meteo air quality data for specific coordinates
+func (c *Client) GetOpenMeteoAirQualityData(ctx context.Context, lat, lon float64) (string, error) {
+	return c.Get(ctx, c.OpenMeteoAirQualityKey(lat, lon))
+}
+
+// SetOpenMeteoAirQualityData caches Open-Meteo air quality data for specific coordinates with 1-hour TTL
+func (c *Client) SetOpenMeteoAirQualityData(ctx context.Context, lat, lon float64, data interface{}) error {
+	return c.Set(ctx, c.OpenMeteoAirQualityKey(lat, lon), data, time.Hour)
+}
+
+// SetWeatherProviderExhausted marks that the provider ran out of quota, the mark expires after ttl
+func (c *Client) SetWeatherProviderExhausted(ctx context.Context, provider string, ttl time.Duration) error {
+	return c.Set(ctx, "weather_provider_exhausted:"+provider, time.Now().Unix(), ttl)
+}
+
+// IsWeatherProviderExhausted checks if the provider ran out of quota recently
+func (c *Client) IsWeatherProviderExhausted(ctx context.Context, provider string) (bool, error) {
+	return c.Exists(ctx, "weather_provider_exhausted:"+provider)
+}
+
+// GetGeocodingData retrieves cached geocoding results for a place name
+func (c *Client) GetGeocodingData(ctx context.Context, query string) (string, error) {
+	return c.Get(ctx, c.GeocodingKey(query))
+}
+
+// SetGeocodingData caches geocoding results for a place name with 30-day TTL
+func (c *Client) SetGeocodingData(ctx context.Context, query string, data interface{}) error {
+	return c.Set(ctx, c.GeocodingKey(query), data, 30*24*time.Hour)
+}
+
+// GetReverseGeocodingData retrieves cached reverse geocoding results for coordinates
+func (c *Client) GetReverseGeocodingData(ctx context.Context, lat, lon float64) (string, error) {
+	return c.Get(ctx, c.ReverseGeocodingKey(lat, lon))
+}
+
+// SetReverseGeocodingData caches reverse geocoding results for coordinates with 30-day TTL
+func (c *Client) SetReverseGeocodingData(ctx context.Context, lat, lon float64, data interface{}) error {
+	return c.Set(ctx, c.ReverseGeocodingKey(lat, lon), data, 30*24*time.Hour)
+}
+
+// GetTranslations retrieves cached translations by DeepLKey keys in one request, missing ones are empty
+func (c *Client) GetTranslations(ctx context.Context, keys []string) ([]string, error) {
+	values, err := c.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	translations := make([]string, len(values))
+	for i, v := range values {
+		if translation, ok := v.(string); ok {
+			translations[i] = translation
+		}
+	}
+	return translations, nil
+}
+
+// SetTranslation caches translation by its DeepLKey key with 24-hour TTL
+func (c *Client) SetTranslation(ctx context.Context, key, translation string) error {
+	return c.Set(ctx, key, translation, 24*time.Hour)
+}
+
+// GetEntrySummary retrieves the cached summary of a news entry, entry IDs are unique only within their provider
+func (c *Client) GetEntrySummary(ctx context.Context, provider string, entryID int64) (string, error) {
+	return c.Get(ctx, fmt.Sprintf("summary_entry_%s_%d", provider, entryID))
+}
+
+// SetEntrySummary caches the summary of a news entry with 30-day TTL
+func (c *Client) SetEntrySummary(ctx context.Context, provider string, entryID int64, summary string) error {
+	return c.Set(ctx, fmt.Sprintf("summary_entry_%s_%d", provider, entryID), summary, 30*24*time.Hour)
+}
+
+// GetURLSummary retrieves the cached summary of a web page
+func (c *Client) GetURLSummary(ctx context.Context, url string) (string, error) {
+	return c.Get(ctx, c.SummaryURLKey(url))
+}
+
+// SetURLSummary caches the summary of a web page with 7-day TTL
+func (c *Client) SetURLSummary(ctx context.Context, url string, summary string) error {
+	return c.Set(ctx, c.SummaryURLKey(url), summary, 7*24*time.Hour)
 }
 
 // Chat management functions
@@ -202,6 +356,770 @@ func (c *Client) DeleteGPTHistory(ctx context.Context, chatID string) error {
 	return c.Delete(ctx, key)
 }
 
+// User location functions
+
+// UserLocation is a place saved by a user as their personal city
+type UserLocation struct {
+	Name string  `json:"name"`
+	Lat  float64 `json:"lat"`
+	Lon  float64 `json:"lon"`
+}
+
+// SetUserLocation stores the personal location of a user
+func (c *Client) SetUserLocation(ctx context.Context, userID int64, location UserLocation) error {
+	key := fmt.Sprintf("user_location:%d", userID)
+	data, err := json.Marshal(location)
+	if err != nil {
+		return err
+	}
+	return c.Set(ctx, key, data, 0)
+}
+
+// GetUserLocation retrieves the personal location of a user, nil is returned if it is not set
+func (c *Client) GetUserLocation(ctx context.Context, userID int64) (*UserLocation, error) {
+	key := fmt.Sprintf("user_location:%d", userID)
+	data, err := c.Get(ctx, key)
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var location UserLocation
+	if err := json.Unmarshal([]byte(data), &location); err != nil {
+		return nil, err
+	}
+	return &location, nil
+}
+
+// DeleteUserLocation removes the personal location of a user
+func (c *Client) DeleteUserLocation(ctx context.Context, userID int64) error {
+	return c.Delete(ctx, fmt.Sprintf("user_location:%d", userID))
+}
+
+// RequestUserLocation marks that the next location shared by the user should be saved, the request expires in 10 minutes
+func (c *Client) RequestUserLocation(ctx context.Context, userID int64) error {
+	return c.Set(ctx, fmt.Sprintf("user_location_request:%d", userID), "pending", 10*time.Minute)
+}
+
+// PopUserLocationRequest checks if the user has requested to save a location and clears the request
+func (c *Client) PopUserLocationRequest(ctx context.Context, userID int64) (bool, error) {
+	deleted, err := c.client.Del(ctx, fmt.Sprintf("user_location_request:%d", userID)).Result()
+	return deleted > 0, err
+}
+
+// Weather city functions
+
+// WeatherCity is a city shown in weather forecasts
+type WeatherCity struct {
+	Name string  `json:"name"`
+	Lat  float64 `json:"lat"`
+	Lon  float64 `json:"lon"`
+}
+
+// GetWeatherCities retrieves weather cities in display order, nil is returned if cities were never stored
+func (c *Client) GetWeatherCities(ctx context.Context) ([]WeatherCity, error) {
+	data, err := c.Get(ctx, "weather_cities")
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	cities := make([]WeatherCity, 0)
+	err = json.Unmarshal([]byte(data), &cities)
+	return cities, err
+}
+
+// SetWeatherCities stores weather cities in display order
+func (c *Client) SetWeatherCities(ctx context.Context, cities []WeatherCity) error {
+	data, err := json.Marshal(cities)
+	if err != nil {
+		return err
+	}
+	return c.Set(ctx, "weather_cities", data, 0)
+}
+
+// GetChatWeatherCities retrieves names of cities selected for a chat, empty list means all cities
+func (c *Client) GetChatWeatherCities(ctx context.Context, chatID int64) ([]string, error) {
+	data, err := c.Get(ctx, fmt.Sprintf("weather_chat_cities:%d", chatID))
+	if err != nil {
+		if err == redis.Nil {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+
+	var names []string
+	err = json.Unmarshal([]byte(data), &names)
+	return names, err
+}
+
+// SetChatWeatherCities stores names of cities selected for a chat, empty list resets the selection
+func (c *Client) SetChatWeatherCities(ctx context.Context, chatID int64, names []string) error {
+	key := fmt.Sprintf("weather_chat_cities:%d", chatID)
+	if len(names) == 0 {
+		return c.Delete(ctx, key)
+	}
+	data, err := json.Marshal(names)
+	if err != nil {
+		return err
+	}
+	return c.Set(ctx, key, data, 0)
+}
+
+// Weather alert functions
+
+// WeatherAlertSettings holds per-chat thresholds for severe weather alerts
+type WeatherAlertSettings struct {
+	FrostTemp    float64 `json:"frost_temp"`    // alert when the day minimum is at or below, °C
+	HeatTemp     float64 `json:"heat_temp"`     // alert when the day maximum is at or above, °C
+	WindGust     float64 `json:"wind_gust"`     // alert when wind gusts reach, m/s
+	PopThreshold float64 `json:"pop_threshold"` // minimal probability of heavy rain or snow, 0..1
+	TempDrop     float64 `json:"temp_drop"`     // alert when the day maximum drops by, °C
+	AQI          int     `json:"aqi"`           // alert when the air quality index reaches, 1..5, 0 disables
+	QuietFrom    int     `json:"quiet_from"`    // hour when quiet hours start
+	QuietTo      int     `json:"quiet_to"`      // hour when quiet hours end
+}
+
+// DefaultWeatherAlertSettings are used for chats that have not changed the thresholds
+var DefaultWeatherAlertSettings = WeatherAlertSettings{
+	FrostTemp:    -15,
+	HeatTemp:     30,
+	WindGust:     15,
+	PopThreshold: 0.7,
+	TempDrop:     10,
+	AQI:          4,
+	QuietFrom:    22,
+	QuietTo:      8,
+}
+
+// GetWeatherAlertSettings retrieves weather alert settings of a chat, defaults are returned if they are not set
+func (c *Client) GetWeatherAlertSettings(ctx context.Context, chatID int64) (WeatherAlertSettings, error) {
+	settings := DefaultWeatherAlertSettings
+	data, err := c.Get(ctx, fmt.Sprintf("weather_alert_settings:%d", chatID))
+	if err != nil {
+		if err == redis.Nil {
+			return settings, nil
+		}
+		return settings, err
+	}
+	err = json.Unmarshal([]byte(data), &settings)
+	return settings, err
+}
+
+// SetWeatherAlertSettings stores weather alert settings of a chat
+func (c *Client) SetWeatherAlertSettings(ctx context.Context, chatID int64, settings WeatherAlertSettings) error {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	return c.Set(ctx, fmt.Sprintf("weather_alert_settings:%d", chatID), data, 0)
+}
+
+// EnableWeatherAlerts subscribes a chat to weather alerts
+func (c *Client) EnableWeatherAlerts(ctx context.Context, chatID int64) error {
+	return c.client.SAdd(ctx, "weather_alert_chats", chatID).Err()
+}
+
+// DisableWeatherAlerts unsubscribes a chat from weather alerts
+func (c *Client) DisableWeatherAlerts(ctx context.Context, chatID int64) error {
+	return c.client.SRem(ctx, "weather_alert_chats", chatID).Err()
+}
+
+// IsWeatherAlertsEnabled checks if a chat is subscribed to weather alerts
+func (c *Client) IsWeatherAlertsEnabled(ctx context.Context, chatID int64) (bool, error) {
+	return c.client.SIsMember(ctx, "weather_alert_chats", chatID).Result()
+}
+
+// GetWeatherAlertChats returns IDs of all chats subscribed to weather alerts
+func (c *Client) GetWeatherAlertChats(ctx context.Context) ([]int64, error) {
+	members, err := c.client.SMembers(ctx, "weather_alert_chats").Result()
+	if err != nil {
+		return nil, err
+	}
+	chatIDs := make([]int64, 0, len(members))
+	for _, m := range members {
+		chatIDs = append(chatIDs, parseIntOrDefault(m, 0))
+	}
+	return chatIDs, nil
+}
+
+// MarkWeatherAlertSent remembers that the event was reported to the chat,
+// false is returned if it has been reported already
+func (c *Client) MarkWeatherAlertSent(ctx context.Context, chatID int64, event string) (bool, error) {
+	key := fmt.Sprintf("weather_alert_sent:%d:%s", chatID, event)
+	return c.client.SetNX(ctx, key, time.Now().Unix(), 7*24*time.Hour).Result()
+}
+
+// Currency pair functions
+
+// DefaultCurrencyPairs are shown in chats that have not changed the list of pairs
+var DefaultCurrencyPairs = []string{"USD/RUB", "EUR/RUB", "BTC/USD"}
+
+// GetCurrencyPairs retrieves currency pairs of a chat, defaults are returned if they are not set
+func (c *Client) GetCurrencyPairs(ctx context.Context, chatID int64) ([]string, error) {
+	data, err := c.Get(ctx, fmt.Sprintf("currency_pairs:%d", chatID))
+	if err != nil {
+		if err == redis.Nil {
+			return slices.Clone(DefaultCurrencyPairs), nil
+		}
+		return nil, err
+	}
+	var pairs []string
+	err = json.Unmarshal([]byte(data), &pairs)
+	return pairs, err
+}
+
+// SetCurrencyPairs stores currency pairs of a chat
+func (c *Client) SetCurrencyPairs(ctx context.Context, chatID int64, pairs []string) error {
+	data, err := json.Marshal(pairs)
+	if err != nil {
+		return err
+	}
+	return c.Set(ctx, fmt.Sprintf("currency_pairs:%d", chatID), data, 0)
+}
+
+// ResetCurrencyPairs restores the default currency pairs of a chat
+func (c *Client) ResetCurrencyPairs(ctx context.Context, chatID int64) error {
+	return c.Delete(ctx, fmt.Sprintf("currency_pairs:%d", chatID))
+}
+
+// Currency history functions
+
+// SetCurrencyHistory stores end-of-day rates of the provider by currency code, the history never expires
+func (c *Client) SetCurrencyHistory(ctx context.Context, provider string, date time.Time, rates map[string]float64) error {
+	data, err := json.Marshal(rates)
+	if err != nil {
+		return err
+	}
+	return c.client.HSet(ctx, "currency_history:"+provider, date.Format("2006-01-02"), data).Err()
+}
+
+// GetCurrencyHistory retrieves stored rates of the provider for the given dates, missing days are nil
+func (c *Client) GetCurrencyHistory(ctx context.Context, provider string, dates []time.Time) ([]map[string]float64, error) {
+	if len(dates) == 0 {
+		return nil, nil
+	}
+	fields := make([]string, 0, len(dates))
+	for _, d := range dates {
+		fields = append(fields, d.Format("2006-01-02"))
+	}
+	values, err := c.client.HMGet(ctx, "currency_history:"+provider, fields...).Result()
+	if err != nil {
+		return nil, err
+	}
+	history := make([]map[string]float64, len(values))
+	for i, v := range values {
+		data, ok := v.(string)
+		if !ok {
+			continue
+		}
+		if err := json.Unmarshal([]byte(data), &history[i]); err != nil {
+			return nil, err
+		}
+	}
+	return history, nil
+}
+
+// Currency alert functions
+
+// CurrencyAlert is a subscription of a chat to a currency pair crossing a threshold
+type CurrencyAlert struct {
+	ID    int     `json:"id"`
+	Pair  string  `json:"pair"`
+	Kind  string  `json:"kind"`  // above, below or change
+	Value float64 `json:"value"` // rate for above and below, percent for change
+	// Triggered is set after the notification and cleared when the rate moves back past the hysteresis band.
+	// It is kept apart from the list, so the alert checker does not overwrite alerts added or removed meanwhile
+	Triggered bool `json:"-"`
+}
+
+// GetCurrencyAlerts retrieves currency alerts of a chat with their triggered state
+func (c *Client) GetCurrencyAlerts(ctx context.Context, chatID int64) ([]CurrencyAlert, error) {
+	alerts := make([]CurrencyAlert, 0)
+	data, err := c.Get(ctx, fmt.Sprintf("currency_alerts:%d", chatID))
+	if err != nil {
+		if err == redis.Nil {
+			return alerts, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(data), &alerts); err != nil {
+		return nil, err
+	}
+	triggered, err := c.client.HGetAll(ctx, fmt.Sprintf("currency_alert_state:%d", chatID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i := range alerts {
+		_, alerts[i].Triggered = triggered[strconv.Itoa(alerts[i].ID)]
+	}
+	return alerts, nil
+}
+
+// SetCurrencyAlerts stores currency alerts of a chat, chats without alerts are not checked.
+// The triggered state is not stored, it is changed with SetCurrencyAlertTriggered
+func (c *Client) SetCurrencyAlerts(ctx context.Context, chatID int64, alerts []CurrencyAlert) error {
+	key := fmt.Sprintf("currency_alerts:%d", chatID)
+	if len(alerts) == 0 {
+		if err := c.client.Del(ctx, key, fmt.Sprintf("currency_alert_state:%d", chatID)).Err(); err != nil {
+			return err
+		}
+		return c.client.SRem(ctx, "currency_alert_chats", chatID).Err()
+	}
+	data, err := json.Marshal(alerts)
+	if err != nil {
+		return err
+	}
+	if err := c.Set(ctx, key, data, 0); err != nil {
+		return err
+	}
+	return c.client.SAdd(ctx, "currency_alert_chats", chatID).Err()
+}
+
+// SetCurrencyAlertTriggered stores the triggered state of a currency alert
+func (c *Client) SetCurrencyAlertTriggered(ctx context.Context, chatID int64, alertID int, triggered bool) error {
+	key := fmt.Sprintf("currency_alert_state:%d", chatID)
+	if triggered {
+		return c.client.HSet(ctx, key, strconv.Itoa(alertID), 1).Err()
+	}
+	return c.client.HDel(ctx, key, strconv.Itoa(alertID)).Err()
+}
+
+// GetCurrencyAlertChats returns IDs of all chats with currency alerts
+func (c *Client) GetCurrencyAlertChats(ctx context.Context) ([]int64, error) {
+	members, err := c.client.SMembers(ctx, "currency_alert_chats").Result()
+	if err != nil {
+		return nil, err
+	}
+	chatIDs := make([]int64, 0, len(members))
+	for _, m := range members {
+		chatIDs = append(chatIDs, parseIntOrDefault(m, 0))
+	}
+	return chatIDs, nil
+}
+
+// News source functions
+
+// NewsSource is a news feed of the digest selected by feed ID, category ID or site URL
+type NewsSource struct {
+	FeedID     int64  `json:"feed_id,omitempty"`
+	CategoryID int64  `json:"category_id,omitempty"`
+	SiteURL    string `json:"site_url,omitempty"`
+	Count      int    `json:"count"`
+	Translate  string `json:"translate,omitempty"` // target language of titles, empty keeps the original
+	Summarize  bool   `json:"summarize,omitempty"` // show an AI summary under each headline
+	Label      string `json:"label"`
+}
+
+// DefaultNewsSources are shown in chats that have not changed the list of news sources
+var DefaultNewsSources = []NewsSource{
+	{SiteURL: "https://www.nytimes.com", Count: 3, Translate: "RU", Label: "New York Times"},
+	{SiteURL: "https://tass.ru", Count: 2, Label: "ТАСС"},
+}
+
+// GetNewsSources retrieves news sources of a chat, defaults are returned if they are not set
+func (c *Client) GetNewsSources(ctx context.Context, chatID int64) ([]NewsSource, error) {
+	data, err := c.Get(ctx, fmt.Sprintf("news_sources:%d", chatID))
+	if err != nil {
+		if err == redis.Nil {
+			return slices.Clone(DefaultNewsSources), nil
+		}
+		return nil, err
+	}
+	var sources []NewsSource
+	err = json.Unmarshal([]byte(data), &sources)
+	return sources, err
+}
+
+// SetNewsSources stores news sources of a chat
+func (c *Client) SetNewsSources(ctx context.Context, chatID int64, sources []NewsSource) error {
+	data, err := json.Marshal(sources)
+	if err != nil {
+		return err
+	}
+	return c.Set(ctx, fmt.Sprintf("news_sources:%d", chatID), data, 0)
+}
+
+// ResetNewsSources restores the default news sources of a chat
+func (c *Client) ResetNewsSources(ctx context.Context, chatID int64) error {
+	return c.Delete(ctx, fmt.Sprintf("news_sources:%d", chatID))
+}
+
+// News subscription functions
+
+// NewsSubscription pushes new entries of a news feed or category to a chat
+type NewsSubscription struct {
+	ID         int      `json:"id"`
+	FeedID     int64    `json:"feed_id,omitempty"`
+	CategoryID int64    `json:"category_id,omitempty"`
+	Label      string   `json:"label"`
+	Translate  string   `json:"translate,omitempty"` // target language of titles, empty keeps the original
+	Keywords   []string `json:"keywords,omitempty"`  // entries must mention one of them, -word excludes entries
+}
+
+// GetNewsSubscriptions retrieves news subscriptions of a chat
+func (c *Client) GetNewsSubscriptions(ctx context.Context, chatID int64) ([]NewsSubscription, error) {
+	subscriptions := make([]NewsSubscription, 0)
+	data, err := c.Get(ctx, fmt.Sprintf("news_subscriptions:%d", chatID))
+	if err != nil {
+		if err == redis.Nil {
+			return subscriptions, nil
+		}
+		return nil, err
+	}
+	err = json.Unmarshal([]byte(data), &subscriptions)
+	return subscriptions, err
+}
+
+// SetNewsSubscriptions stores news subscriptions of a chat, chats without subscriptions are not polled
+func (c *Client) SetNewsSubscriptions(ctx context.Context, chatID int64, subscriptions []NewsSubscription) error {
+	key := fmt.Sprintf("news_subscriptions:%d", chatID)
+	if len(subscriptions) == 0 {
+		if err := c.Delete(ctx, key); err != nil {
+			return err
+		}
+		return c.client.SRem(ctx, "news_subscription_chats", chatID).Err()
+	}
+	data, err := json.Marshal(subscriptions)
+	if err != nil {
+		return err
+	}
+	if err := c.Set(ctx, key, data, 0); err != nil {
+		return err
+	}
+	return c.client.SAdd(ctx, "news_subscription_chats", chatID).Err()
+}
+
+// GetNewsSubscriptionChats returns IDs of all chats with news subscriptions
+func (c *Client) GetNewsSubscriptionChats(ctx context.Context) ([]int64, error) {
+	members, err := c.client.SMembers(ctx, "news_subscription_chats").Result()
+	if err != nil {
+		return nil, err
+	}
+	chatIDs := make([]int64, 0, len(members))
+	for _, m := range members {
+		chatIDs = append(chatIDs, parseIntOrDefault(m, 0))
+	}
+	return chatIDs, nil
+}
+
+// GetNewsLastSeen returns the last pushed entry ID of the subscription, 0 if nothing was pushed yet
+func (c *Client) GetNewsLastSeen(ctx context.Context, chatID int64, subscriptionID int) (int64, error) {
+	data, err := c.Get(ctx, fmt.Sprintf("news_last_seen:%d:%d", chatID, subscriptionID))
+	if err != nil {
+		if err == redis.Nil {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return strconv.ParseInt(data, 10, 64)
+}
+
+// SetNewsLastSeen stores the last pushed entry ID of the subscription
+func (c *Client) SetNewsLastSeen(ctx context.Context, chatID int64, subscriptionID int, entryID int64) error {
+	return c.Set(ctx, fmt.Sprintf("news_last_seen:%d:%d", chatID, subscriptionID), entryID, 0)
+}
+
+// DeleteNewsLastSeen removes the last pushed entry ID of a removed subscription
+func (c *Client) DeleteNewsLastSeen(ctx context.Context, chatID int64, subscriptionID int) error {
+	return c.Delete(ctx, fmt.Sprintf("news_last_seen:%d:%d", chatID, subscriptionID))
+}
+
+// Posted news functions
+
+// postedNewsTTL is how long news posted to a chat are kept out of its digests
+const postedNewsTTL = 7 * 24 * time.Hour
+
+// GetPostedNews returns keys of news posted to a chat within postedNewsTTL, older keys are dropped
+func (c *Client) GetPostedNews(ctx context.Context, chatID int64) ([]string, error) {
+	key := fmt.Sprintf("news_posted:%d", chatID)
+	expired := strconv.FormatInt(time.Now().Add(-postedNewsTTL).Unix(), 10)
+	if err := c.client.ZRemRangeByScore(ctx, key, "-inf", "("+expired).Err(); err != nil {
+		return nil, err
+	}
+	return c.client.ZRange(ctx, key, 0, -1).Result()
+}
+
+// AddPostedNews remembers keys of news posted to a chat: entry IDs and title signatures
+func (c *Client) AddPostedNews(ctx context.Context, chatID int64, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	key := fmt.Sprintf("news_posted:%d", chatID)
+	now := float64(time.Now().Unix())
+	members := make([]redis.Z, 0, len(keys))
+	for _, k := range keys {
+		members = append(members, redis.Z{Score: now, Member: k})
+	}
+	if err := c.client.ZAdd(ctx, key, members...).Err(); err != nil {
+		return err
+	}
+	return c.client.Expire(ctx, key, postedNewsTTL).Err()
+}
+
+// SetFuzzyNewsDedup turns merging of similar headlines from different feeds on or off for a chat
+func (c *Client) SetFuzzyNewsDedup(ctx context.Context, chatID int64, enabled bool) error {
+	if !enabled {
+		return c.client.SRem(ctx, "news_fuzzy_dedup_chats", chatID).Err()
+	}
+	return c.client.SAdd(ctx, "news_fuzzy_dedup_chats", chatID).Err()
+}
+
+// IsFuzzyNewsDedupEnabled checks if similar headlines are merged in the chat's digests
+func (c *Client) IsFuzzyNewsDedupEnabled(ctx context.Context, chatID int64) (bool, error) {
+	return c.client.SIsMember(ctx, "news_fuzzy_dedup_chats", chatID).Result()
+}
+
+// RSS feed functions
+
+const (
+	rssEntryTTL = 30 * 24 * time.Hour
+	rssSeenTTL  = 90 * 24 * time.Hour
+	// rssMaxFeedEntries limits the index of entries kept per feed
+	rssMaxFeedEntries = 200
+)
+
+// RSSFeedState is the conditional GET state of a feed fetched by the built-in RSS provider
+type RSSFeedState struct {
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at"`
+}
+
+// GetRSSFeedState retrieves the fetch state of a feed, the zero state is returned if it was never fetched
+func (c *Client) GetRSSFeedState(ctx context.Context, feedID int64) (RSSFeedState, error) {
+	var state RSSFeedState
+	data, err := c.Get(ctx, fmt.Sprintf("rss_feed_state:%d", feedID))
+	if err != nil {
+		if err == redis.Nil {
+			return state, nil
+		}
+		return state, err
+	}
+	err = json.Unmarshal([]byte(data), &state)
+	return state, err
+}
+
+// SetRSSFeedState stores the fetch state of a feed
+func (c *Client) SetRSSFeedState(ctx context.Context, feedID int64, state RSSFeedState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return c.Set(ctx, fmt.Sprintf("rss_feed_state:%d", feedID), data, 0)
+}
+
+// RSSEntryID returns the entry ID of a feed item by its guid, an item seen for the first time
+// gets the next ID of the sequence and isNew is true
+func (c *Client) RSSEntryID(ctx context.Context, feedID int64, guid string) (id int64, isNew bool, err error) {
+	key := fmt.Sprintf("rss_seen:%d", feedID)
+	data, err := c.client.HGet(ctx, key, guid).Result()
+	if err == nil {
+		id, err = strconv.ParseInt(data, 10, 64)
+		return id, false, err
+	}
+	if err != redis.Nil {
+		return 0, false, err
+	}
+
+	id, err = c.client.Incr(ctx, "rss_entry_seq").Result()
+	if err != nil {
+		return 0, false, err
+	}
+	isNew, err = c.client.HSetNX(ctx, key, guid, id).Result()
+	if err != nil {
+		return 0, false, err
+	}
+	if err := c.client.Expire(ctx, key, rssSeenTTL).Err(); err != nil {
+		return 0, false, err
+	}
+	if !isNew {
+		// Another fetch of the same feed stored the item first
+		return c.RSSEntryID(ctx, feedID, guid)
+	}
+	return id, true, nil
+}
+
+// AddRSSEntry stores a new entry of a feed, only the newest rssMaxFeedEntries entries stay in the feed index
+func (c *Client) AddRSSEntry(ctx context.Context, feedID int64, entryID int64, data []byte) error {
+	if err := c.Set(ctx, fmt.Sprintf("rss_entry:%d", entryID), data, rssEntryTTL); err != nil {
+		return err
+	}
+	key := fmt.Sprintf("rss_feed_entries:%d", feedID)
+	if err := c.client.ZAdd(ctx, key, redis.Z{Score: float64(entryID), Member: entryID}).Err(); err != nil {
+		return err
+	}
+	return c.client.ZRemRangeByRank(ctx, key, 0, -rssMaxFeedEntries-1).Err()
+}
+
+// UpdateRSSEntry replaces a stored entry keeping its expiration
+func (c *Client) UpdateRSSEntry(ctx context.Context, entryID int64, data []byte) error {
+	return c.client.SetArgs(ctx, fmt.Sprintf("rss_entry:%d", entryID), data, redis.SetArgs{KeepTTL: true}).Err()
+}
+
+// GetRSSEntryIDs returns IDs of stored entries of a feed, newest first
+func (c *Client) GetRSSEntryIDs(ctx context.Context, feedID int64) ([]int64, error) {
+	members, err := c.client.ZRevRange(ctx, fmt.Sprintf("rss_feed_entries:%d", feedID), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, 0, len(members))
+	for _, m := range members {
+		ids = append(ids, parseIntOrDefault(m, 0))
+	}
+	return ids, nil
+}
+
+// GetRSSEntries retrieves stored entries by ID, expired entries are empty strings
+func (c *Client) GetRSSEntries(ctx context.Context, entryIDs []int64) ([]string, error) {
+	if len(entryIDs) == 0 {
+		return nil, nil
+	}
+	keys := make([]string, 0, len(entryIDs))
+	for _, id := range entryIDs {
+		keys = append(keys, fmt.Sprintf("rss_entry:%d", id))
+	}
+	values, err := c.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]string, len(values))
+	for i, v := range values {
+		if data, ok := v.(string); ok {
+			entries[i] = data
+		}
+	}
+	return entries, nil
+}
+
+// DeepL glossary functions
+
+// GlossaryPair is the language pair of a glossary like en>ru
+func GlossaryPair(sourceLang, targetLang string) string {
+	return strings.ToLower(sourceLang + ">" + targetLang)
+}
+
+// GetGlossaryPairs returns language pairs that have glossary entries
+func (c *Client) GetGlossaryPairs(ctx context.Context) ([]string, error) {
+	pairs, err := c.client.SMembers(ctx, "deepl_glossary_pairs").Result()
+	slices.Sort(pairs)
+	return pairs, err
+}
+
+// GetGlossaryEntries retrieves terms of the glossary of a language pair with their translations
+func (c *Client) GetGlossaryEntries(ctx context.Context, pair string) (map[string]string, error) {
+	return c.client.HGetAll(ctx, "deepl_glossary_entries:"+pair).Result()
+}
+
+// SetGlossaryEntry adds or replaces a term of the glossary of a language pair
+func (c *Client) SetGlossaryEntry(ctx context.Context, pair, term, translation string) error {
+	if err := c.client.HSet(ctx, "deepl_glossary_entries:"+pair, term, translation).Err(); err != nil {
+		return err
+	}
+	return c.client.SAdd(ctx, "deepl_glossary_pairs", pair).Err()
+}
+
+// DeleteGlossaryEntry removes a term of the glossary of a language pair, it reports if the term existed
+func (c *Client) DeleteGlossaryEntry(ctx context.Context, pair, term string) (bool, error) {
+	n, err := c.client.HDel(ctx, "deepl_glossary_entries:"+pair, term).Result()
+	if err != nil {
+		return false, err
+	}
+	left, err := c.client.HLen(ctx, "deepl_glossary_entries:"+pair).Result()
+	if err == nil && left == 0 {
+		err = c.client.SRem(ctx, "deepl_glossary_pairs", pair).Err()
+	}
+	return n > 0, err
+}
+
+// DeleteGlossaryEntries removes all terms of the glossary of a language pair
+func (c *Client) DeleteGlossaryEntries(ctx context.Context, pair string) error {
+	if err := c.Delete(ctx, "deepl_glossary_entries:"+pair); err != nil {
+		return err
+	}
+	return c.client.SRem(ctx, "deepl_glossary_pairs", pair).Err()
+}
+
+// GetGlossaryIDs returns IDs of glossaries created in DeepL by language pair
+func (c *Client) GetGlossaryIDs(ctx context.Context) (map[string]string, error) {
+	return c.client.HGetAll(ctx, "deepl_glossary_ids").Result()
+}
+
+// SetGlossaryID stores the DeepL ID of the glossary of a language pair, an empty ID removes it
+func (c *Client) SetGlossaryID(ctx context.Context, pair, glossaryID string) error {
+	if glossaryID == "" {
+		return c.client.HDel(ctx, "deepl_glossary_ids", pair).Err()
+	}
+	return c.client.HSet(ctx, "deepl_glossary_ids", pair, glossaryID).Err()
+}
+
+// Auto-translation functions
+
+// AutoTranslateSettings holds per-chat settings of replying with translations to messages in other languages
+type AutoTranslateSettings struct {
+	Enabled       bool     `json:"enabled"`
+	Languages     []string `json:"languages"`      // preferred languages, others are translated into the first one
+	MinLength     int      `json:"min_length"`     // shorter messages are not translated, characters
+	ExcludedUsers []int64  `json:"excluded_users"` // messages of these users are not translated
+	DailyBudget   int      `json:"daily_budget"`   // DeepL characters per day, translation stops when it is spent
+}
+
+// DefaultAutoTranslateSettings are used for chats that have not changed the settings
+var DefaultAutoTranslateSettings = AutoTranslateSettings{
+	Languages:   []string{"ru"},
+	MinLength:   20,
+	DailyBudget: 5000,
+}
+
+// GetAutoTranslateSettings retrieves auto-translation settings of a chat, defaults are returned if they are not set
+func (c *Client) GetAutoTranslateSettings(ctx context.Context, chatID int64) (AutoTranslateSettings, error) {
+	settings := DefaultAutoTranslateSettings
+	settings.Languages = slices.Clone(settings.Languages)
+	data, err := c.Get(ctx, fmt.Sprintf("auto_translate_settings:%d", chatID))
+	if err != nil {
+		if err == redis.Nil {
+			return settings, nil
+		}
+		return settings, err
+	}
+	err = json.Unmarshal([]byte(data), &settings)
+	return settings, err
+}
+
+// SetAutoTranslateSettings stores auto-translation settings of a chat
+func (c *Client) SetAutoTranslateSettings(ctx context.Context, chatID int64, settings AutoTranslateSettings) error {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	return c.Set(ctx, fmt.Sprintf("auto_translate_settings:%d", chatID), data, 0)
+}
+
+// GetAutoTranslateChars returns the number of characters auto-translated with DeepL in a chat today
+func (c *Client) GetAutoTranslateChars(ctx context.Context, chatID int64) (int, error) {
+	data, err := c.Get(ctx, fmt.Sprintf("auto_translate_chars:%d:%s", chatID, time.Now().Format("2006-01-02")))
+	if err != nil {
+		if err == redis.Nil {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return int(parseIntOrDefault(data, 0)), nil
+}
+
+// AddAutoTranslateChars counts characters auto-translated with DeepL in a chat today
+func (c *Client) AddAutoTranslateChars(ctx context.Context, chatID int64, chars int) error {
+	key := fmt.Sprintf("auto_translate_chars:%d:%s", chatID, time.Now().Format("2006-01-02"))
+	if err := c.client.IncrBy(ctx, key, int64(chars)).Err(); err != nil {
+		return err
+	}
+	return c.client.Expire(ctx, key, 48*time.Hour).Err()
+}
+
 // Chat info storage functions
 
 // StoreChatInfo stores additional information about a chat (username for private, group name for groups)
@@ -26,10 +26,13 @@ var opts struct {
 	} `group:"telegram" namespace:"telegram" env-namespace:"TG"`
 	WeatherAPI struct {
 		Key        string `long:"key" env:"KEY"`
+		Provider   string `long:"provider" env:"PROVIDER" default:"openweather" description:"primary weather provider: openweather or openmeteo"`
 		ConfigFile string `long:"configfile" env:"configfile" default:"weatherapi_config.json" description:"config file for weather api"`
 	} `group:"weatherapi" namespace:"weatherapi" env-namespace:"WEATHERAPI"`
 	CurrencyAPI struct {
-		Key string `long:"key" env:"KEY"`
+		Key           string `long:"key" env:"KEY"`
+		Providers     string `long:"providers" env:"PROVIDERS" default:"currencyapi,cbr,ecb" description:"comma-separated exchange rates providers in the fallback order: currencyapi, cbr, ecb"`
+		PairProviders string `long:"pairproviders" env:"PAIRPROVIDERS" default:"" description:"provider order per currency pair, e.g. USD/RUB=cbr,currencyapi;EUR/USD=ecb"`
 	} `group:"currencyapi" namespace:"currencyapi" env-namespace:"CURRENCYAPI"`
 	OpenaiAPI struct {
 		Key string `long:"key" env:"KEY"`
@@ -38,6 +41,10 @@ var opts struct {
 		Key     string `long:"key" env:"KEY"`
 		BaseURL string `long:"baseurl" env:"BASEURL"`
 	} `group:"minifluxapi" namespace:"minifluxapi" env-namespace:"MINIFLUXAPI"`
+	News struct {
+		Provider  string `long:"provider" env:"PROVIDER" default:"miniflux" description:"news provider: miniflux or rss"`
+		FeedsFile string `long:"feedsfile" env:"FEEDSFILE" default:"news_feeds.json" description:"feeds of the rss news provider"`
+	} `group:"news" namespace:"news" env-namespace:"NEWS"`
 	DeeplAPI struct {
 		Key     string `long:"key" env:"KEY"`
 		BaseURL string `long:"baseurl" env:"BASEURL" default:"https://api-free.deepl.com"`
@@ -94,11 +101,13 @@ func main() {
 	httpClient := &http.Client{Timeout: 60 * time.Second}
 	dbClient := db.NewClient(opts.RedisAddr)
 
-	exchangeAPI := &apiclient.ExchangeAPI{
-		ApiKey:     opts.CurrencyAPI.Key,
-		DBClient:   dbClient,
-		HttpClient: httpClient,
-	}
+	exchangeAPI := apiclient.NewExchangeAPI(
+		opts.CurrencyAPI.Key,
+		opts.CurrencyAPI.Providers,
+		opts.CurrencyAPI.PairProviders,
+		httpClient,
+		dbClient,
+	)
 	openaiAPI := &apiclient.OpenaiAPI{
 		ApiKey:     opts.OpenaiAPI.Key,
 		HttpClient: httpClient,
@@ -109,11 +118,18 @@ func main() {
 		ApiKey:     opts.DeeplAPI.Key,
 		BaseURL:    opts.DeeplAPI.BaseURL,
 	}
-	minifluxAPI := &apiclient.MinifluxAPI{
-		ApiKey:  opts.MinifluxAPI.Key,
-		BaseURL: opts.MinifluxAPI.BaseURL,
+	newsAPI := apiclient.NewNewsProvider(opts.News.Provider, opts.MinifluxAPI.BaseURL, opts.MinifluxAPI.Key, opts.News.FeedsFile, httpClient, dbClient)
+	summarizer := &apiclient.Summarizer{
+		HttpClient:   apiclient.NewPublicHTTPClient(60 * time.Second),
+		DBClient:     dbClient,
+		OpenaiAPI:    openaiAPI,
+		NewsProvider: newsAPI.Name(),
+	}
+	translator := &apiclient.Translator{
+		DeeplAPI:  deeplAPI,
+		OpenaiAPI: openaiAPI,
 	}
-	weatherAPI := apiclient.NewWeatherAPI(opts.WeatherAPI.Key, opts.WeatherAPI.ConfigFile, httpClient, dbClient)
+	weatherAPI := apiclient.NewWeatherAPI(opts.WeatherAPI.Key, opts.WeatherAPI.Provider, opts.WeatherAPI.ConfigFile, httpClient, dbClient)
 
 	adminUserIDs, err := ConvertCommaSeparatedStringToInt64Slice(opts.Telegram.AdminUserIDs)
 	if err != nil {
@@ -132,8 +148,10 @@ func main() {
 		OpenaiAPI:    openaiAPI,
 		WeatherAPI:   weatherAPI,
 		TGBotAPI:     bot_api,
-		MinifluxAPI:  minifluxAPI,
+		NewsAPI:      newsAPI,
 		DeeplAPI:     deeplAPI,
+		Summarizer:   summarizer,
+		Translator:   translator,
 		DBClient:     dbClient,
 	}
 
@@ -11,6 +11,18 @@ var (
 		Help: "The total number of mourning job",
 	})
 )
+var (
+	EveningJobCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "familybot_evening_job_total",
+		Help: "The total number of evening job",
+	})
+)
+var (
+	WeeklyJobCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "familybot_weekly_job_total",
+		Help: "The total number of weekly job",
+	})
+)
 var (
 	RecvMsgCounter = promauto.NewCounter(prometheus.CounterOpts{
 		Name: "familybot_recieved_msg_total",
@@ -29,3 +41,57 @@ var (
 		Help: "The total number of command calls",
 	}, []string{"command"})
 )
+var (
+	CallbackCallsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "familybot_callback_calls_total",
+		Help: "The total number of inline keyboard callback calls",
+	}, []string{"callback"})
+)
+var (
+	WeatherAlertCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "familybot_weather_alert_total",
+		Help: "The total number of sent weather alerts",
+	})
+)
+var (
+	CurrencyAlertCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "familybot_currency_alert_total",
+		Help: "The total number of sent currency alerts",
+	})
+)
+var (
+	MinifluxRequestCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "familybot_miniflux_requests_total",
+		Help: "The total number of Miniflux API requests by response status",
+	}, []string{"status"})
+)
+var (
+	MinifluxRequestDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name: "familybot_miniflux_request_duration_seconds",
+		Help: "Duration of Miniflux API requests",
+	})
+)
+var (
+	NewsFeedCacheCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "familybot_miniflux_feed_cache_total",
+		Help: "The total number of Miniflux feed index lookups by result (hit or miss)",
+	}, []string{"result"})
+)
+var (
+	NewsPushCounter = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "familybot_news_push_total",
+		Help: "The total number of pushed news entries",
+	})
+)
+var (
+	NewsDedupCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "familybot_news_dedup_skipped_total",
+		Help: "The total number of digest news entries skipped as already posted by match (id or title)",
+	}, []string{"match"})
+)
+var (
+	AutoTranslateCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "familybot_auto_translate_total",
+		Help: "The total number of messages in other languages by result (translated, budget or error)",
+	}, []string{"result"})
+)
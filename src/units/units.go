@@ -0,0 +1,131 @@
+// Package units converts common units of length, weight, temperature, volume and speed
+package units
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Dimension is a physical quantity, only units of the same dimension can be converted
+type Dimension string
+
+const (
+	Length      Dimension = "length"
+	Weight      Dimension = "weight"
+	Temperature Dimension = "temperature"
+	Volume      Dimension = "volume"
+	Speed       Dimension = "speed"
+)
+
+// Unit is a linear conversion to the base unit of the dimension: base = value*Factor + Offset
+type Unit struct {
+	Symbol    string
+	Dimension Dimension
+	Factor    float64
+	Offset    float64
+	// Counterpart is the unit of the other measurement system used when the target is not given
+	Counterpart string
+}
+
+// units are keyed by symbol, base units are meter, kilogram, degree Celsius, liter and meter per second
+var units = map[string]Unit{
+	"mm": {Symbol: "mm", Dimension: Length, Factor: 0.001, Counterpart: "in"},
+	"cm": {Symbol: "cm", Dimension: Length, Factor: 0.01, Counterpart: "in"},
+	"m":  {Symbol: "m", Dimension: Length, Factor: 1, Counterpart: "ft"},
+	"km": {Symbol: "km", Dimension: Length, Factor: 1000, Counterpart: "mi"},
+	"in": {Symbol: "in", Dimension: Length, Factor: 0.0254, Counterpart: "cm"},
+	"ft": {Symbol: "ft", Dimension: Length, Factor: 0.3048, Counterpart: "m"},
+	"yd": {Symbol: "yd", Dimension: Length, Factor: 0.9144, Counterpart: "m"},
+	"mi": {Symbol: "mi", Dimension: Length, Factor: 1609.344, Counterpart: "km"},
+
+	"g":  {Symbol: "g", Dimension: Weight, Factor: 0.001, Counterpart: "oz"},
+	"kg": {Symbol: "kg", Dimension: Weight, Factor: 1, Counterpart: "lb"},
+	"t":  {Symbol: "t", Dimension: Weight, Factor: 1000, Counterpart: "lb"},
+	"oz": {Symbol: "oz", Dimension: Weight, Factor: 0.028349523125, Counterpart: "g"},
+	"lb": {Symbol: "lb", Dimension: Weight, Factor: 0.45359237, Counterpart: "kg"},
+
+	"°C": {Symbol: "°C", Dimension: Temperature, Factor: 1, Counterpart: "°F"},
+	"°F": {Symbol: "°F", Dimension: Temperature, Factor: 5.0 / 9, Offset: -32 * 5.0 / 9, Counterpart: "°C"},
+	"K":  {Symbol: "K", Dimension: Temperature, Factor: 1, Offset: -273.15, Counterpart: "°C"},
+
+	"ml":    {Symbol: "ml", Dimension: Volume, Factor: 0.001, Counterpart: "fl oz"},
+	"l":     {Symbol: "l", Dimension: Volume, Factor: 1, Counterpart: "gal"},
+	"fl oz": {Symbol: "fl oz", Dimension: Volume, Factor: 0.0295735295625, Counterpart: "ml"},
+	"cup":   {Symbol: "cup", Dimension: Volume, Factor: 0.2365882365, Counterpart: "ml"},
+	"pt":    {Symbol: "pt", Dimension: Volume, Factor: 0.473176473, Counterpart: "l"},
+	"gal":   {Symbol: "gal", Dimension: Volume, Factor: 3.785411784, Counterpart: "l"},
+
+	"m/s":  {Symbol: "m/s", Dimension: Speed, Factor: 1, Counterpart: "km/h"},
+	"km/h": {Symbol: "km/h", Dimension: Speed, Factor: 1 / 3.6, Counterpart: "mph"},
+	"mph":  {Symbol: "mph", Dimension: Speed, Factor: 0.44704, Counterpart: "km/h"},
+	"kn":   {Symbol: "kn", Dimension: Speed, Factor: 1852.0 / 3600, Counterpart: "km/h"},
+}
+
+// aliases map lower-case names and russian forms to unit symbols
+var aliases = map[string]string{
+	"мм": "mm", "миллиметр": "mm", "миллиметров": "mm", "миллиметрах": "mm",
+	"см": "cm", "сантиметр": "cm", "сантиметров": "cm", "сантиметрах": "cm",
+	"м": "m", "метр": "m", "метра": "m", "метров": "m", "метрах": "m", "meter": "m", "meters": "m",
+	"км": "km", "километр": "km", "километра": "km", "километров": "km", "километрах": "km",
+	"inch": "in", "inches": "in", "дюйм": "in", "дюйма": "in", "дюймов": "in", "дюймах": "in", "\"": "in",
+	"foot": "ft", "feet": "ft", "фут": "ft", "фута": "ft", "футов": "ft", "футах": "ft",
+	"yard": "yd", "yards": "yd", "ярд": "yd", "ярда": "yd", "ярдов": "yd", "ярдах": "yd",
+	"mile": "mi", "miles": "mi", "миля": "mi", "мили": "mi", "миль": "mi", "милях": "mi",
+
+	"г": "g", "гр": "g", "грамм": "g", "грамма": "g", "граммов": "g", "граммах": "g",
+	"кг": "kg", "килограмм": "kg", "килограмма": "kg", "килограммов": "kg", "килограммах": "kg",
+	"т": "t", "тонна": "t", "тонны": "t", "тонн": "t", "тоннах": "t",
+	"ounce": "oz", "ounces": "oz", "унция": "oz", "унции": "oz", "унций": "oz", "унциях": "oz",
+	"lbs": "lb", "pound": "lb", "pounds": "lb", "фунт": "lb", "фунта": "lb", "фунтов": "lb", "фунтах": "lb",
+
+	"c": "°C", "°c": "°C", "с": "°C", "°с": "°C", "цельсий": "°C", "цельсия": "°C", "цельсиях": "°C",
+	"f": "°F", "°f": "°F", "фаренгейт": "°F", "фаренгейта": "°F", "фаренгейтах": "°F",
+	"k": "K", "кельвин": "K", "кельвина": "K", "кельвинах": "K",
+
+	"мл": "ml", "миллилитр": "ml", "миллилитров": "ml", "миллилитрах": "ml",
+	"л": "l", "литр": "l", "литра": "l", "литров": "l", "литрах": "l", "liter": "l", "liters": "l",
+	"floz": "fl oz", "fl.oz": "fl oz",
+	"cups": "cup", "чашка": "cup", "чашки": "cup", "чашек": "cup", "чашках": "cup",
+	"pint": "pt", "pints": "pt", "пинта": "pt", "пинты": "pt", "пинт": "pt", "пинтах": "pt",
+	"gallon": "gal", "gallons": "gal", "галлон": "gal", "галлона": "gal", "галлонов": "gal", "галлонах": "gal",
+
+	"м/с": "m/s", "mps": "m/s",
+	"км/ч": "km/h", "kmh": "km/h", "kph": "km/h", "миль/ч": "mph",
+	"knot": "kn", "knots": "kn", "kt": "kn", "узел": "kn", "узла": "kn", "узлов": "kn", "узлах": "kn",
+}
+
+// Lookup finds a unit by symbol or alias, case is ignored except for symbols that need it
+func Lookup(name string) (Unit, bool) {
+	name = strings.TrimSpace(name)
+	if u, ok := units[name]; ok {
+		return u, true
+	}
+	lower := strings.ToLower(name)
+	if u, ok := units[lower]; ok {
+		return u, true
+	}
+	if symbol, ok := aliases[lower]; ok {
+		return units[symbol], true
+	}
+	return Unit{}, false
+}
+
+// Convert converts the amount between units, the target may be empty to use the unit of the other system
+func Convert(amount float64, from, to string) (float64, Unit, Unit, error) {
+	fromUnit, ok := Lookup(from)
+	if !ok {
+		return 0, Unit{}, Unit{}, fmt.Errorf("unknown unit %s", from)
+	}
+	if to == "" {
+		to = fromUnit.Counterpart
+	}
+	toUnit, ok := Lookup(to)
+	if !ok {
+		return 0, Unit{}, Unit{}, fmt.Errorf("unknown unit %s", to)
+	}
+	if fromUnit.Dimension != toUnit.Dimension {
+		return 0, Unit{}, Unit{}, fmt.Errorf("cannot convert %s to %s", fromUnit.Symbol, toUnit.Symbol)
+	}
+	base := amount*fromUnit.Factor + fromUnit.Offset
+	return (base - toUnit.Offset) / toUnit.Factor, fromUnit, toUnit, nil
+}